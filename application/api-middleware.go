@@ -1,15 +1,25 @@
 package application
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
 
 func (app *Application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Access-Control-Allow-Origin", "http://localhost:8090")
+		resp.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if req.Method == "OPTIONS" {
 			resp.Header().Set("Access-Control-Allow-Credentials", "true")
 			resp.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			resp.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization")
+			resp.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization, X-API-Key, If-Match, If-None-Match")
 
 			return
 		}
@@ -20,13 +30,71 @@ func (app *Application) enableCORS(next http.Handler) http.Handler {
 
 func (app *Application) authRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-		_, _, err := app.getTokenFromHeaderAndVerify(resp, req)
+		claims, err := app.authenticateRequest(resp, req)
 
 		if err != nil {
 			resp.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
+		// make the verified claims available to the handlers and middleware further down the chain
+		ctx := context.WithValue(req.Context(), claimsContextKey, claims)
+		req = req.WithContext(ctx)
+
+		if claims.Actor != nil {
+			app.serveImpersonated(next, resp, req, claims)
+			return
+		}
+
 		next.ServeHTTP(resp, req)
 	})
 }
+
+// requirePermission only lets requests through if the caller's token grants permission.
+// It must run after authRequired.
+func (app *Application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			claims, ok := claimsFromContext(req.Context())
+
+			if !ok || !claims.HasPermission(permission) {
+				app.errorJSON(resp, errors.New("Forbidden"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// requireSelfOrPermission only lets requests through if the {userId} in the route is the caller's
+// own ID, or the caller's token grants permission. It must run after authRequired.
+func (app *Application) requireSelfOrPermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			claims, ok := claimsFromContext(req.Context())
+
+			if !ok {
+				app.errorJSON(resp, errors.New("Forbidden"), http.StatusForbidden)
+				return
+			}
+
+			// a client's subject is its client ID, which is never a user's ID
+			isSelf := !claims.IsClient() && claims.Subject == chi.URLParam(req, "userId")
+
+			if !isSelf && !claims.HasPermission(permission) {
+				app.errorJSON(resp, errors.New("Forbidden"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// claimsFromContext returns the claims authRequired stored in the request context
+func claimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+
+	return claims, ok
+}
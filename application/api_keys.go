@@ -0,0 +1,262 @@
+package application
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every API key, so they are easy to spot in scripts and secret scanners. We
+// store it along with the first few characters after it, which is enough for users to tell their
+// keys apart without giving anything useful away.
+const apiKeyPrefix = "key_"
+
+const apiKeyPrefixLength = len(apiKeyPrefix) + 8
+
+var errInvalidAPIKey = errors.New("Invalid API key")
+
+var errAPIKeyNotAllowed = errors.New("API keys cannot be used to change your account")
+
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// createdAPIKey is the response to creating a key; this is the only time the key itself is shown
+type createdAPIKey struct {
+	data.APIKey
+	Key string `json:"key"`
+}
+
+// authenticateRequest checks the caller's credentials: an API key, sent in the X-API-Key header or
+// an Authorization header using the ApiKey scheme, or otherwise a bearer token
+func (app *Application) authenticateRequest(resp http.ResponseWriter, req *http.Request) (*Claims, error) {
+	resp.Header().Add("Vary", "X-API-Key")
+
+	key := req.Header.Get("X-API-Key")
+
+	if scheme, credentials, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && scheme == "ApiKey" {
+		resp.Header().Add("Vary", "Authorization")
+		key = credentials
+	}
+
+	if key != "" {
+		return app.verifyAPIKey(key)
+	}
+
+	_, claims, err := app.getTokenFromHeaderAndVerify(resp, req)
+
+	return claims, err
+}
+
+// verifyAPIKey looks up an API key and returns claims for its user, as if they had sent an access
+// token. Roles and permissions are looked up on each request, so a key never grants more than its
+// user currently has; a key with scopes grants only those of the user's permissions.
+func (app *Application) verifyAPIKey(key string) (*Claims, error) {
+	stored, err := app.DB.GetAPIKey(hashToken(key))
+
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if stored.ExpiresAt != nil && stored.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("API key has expired")
+	}
+
+	user, err := app.DB.GetUser(stored.UserID)
+
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	roles, permissions, err := app.userAuthorization(user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stored.Scopes) > 0 {
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+			return !slices.Contains(stored.Scopes, permission)
+		})
+	}
+
+	err = app.DB.MarkAPIKeyUsed(stored.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		Admin:       slices.Contains(roles, roleAdmin),
+		Roles:       roles,
+		Permissions: permissions,
+		Email:       user.Email,
+		APIKeyID:    stored.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: fmt.Sprint(user.ID),
+		},
+	}, nil
+}
+
+// denyAPIKeys blocks requests made with an API key. Scopes limit what a key can do to permissions,
+// but changing the account itself needs no permission, so it is guarded this way instead. It must
+// run after authRequired.
+func (app *Application) denyAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		claims, ok := claimsFromContext(req.Context())
+
+		if !ok || claims.APIKeyID != 0 {
+			app.errorJSON(resp, errAPIKeyNotAllowed, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+func (app *Application) allAPIKeys(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := app.DB.GetUserAPIKeys(user.ID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if keys == nil {
+		keys = []*data.APIKey{}
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, keys)
+}
+
+// createAPIKey creates a named API key for the caller. Keys can only be given scopes the caller
+// has. The route refuses API keys, so a leaked key can't be used to make more.
+func (app *Application) createAPIKey(resp http.ResponseWriter, req *http.Request) {
+	claims, _ := claimsFromContext(req.Context())
+
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	var payload apiKeyRequest
+
+	err = app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+
+	if payload.Name == "" {
+		app.errorJSON(resp, errors.New("Name is required"), http.StatusBadRequest)
+		return
+	}
+
+	if payload.ExpiresAt != nil && payload.ExpiresAt.Before(time.Now()) {
+		app.errorJSON(resp, errors.New("Expiry must be in the future"), http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range payload.Scopes {
+		if !claims.HasPermission(scope) {
+			app.errorJSON(resp, errors.New("Scope "+scope+" is not one of your permissions"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// a key without scopes has all of its user's permissions, so a token limited to a scope can
+	// only make keys limited to the same permissions
+	if len(payload.Scopes) == 0 && claims.ClientID != "" {
+		if len(claims.Permissions) == 0 {
+			app.errorJSON(resp, errors.New("This token has no permissions to give an API key"), http.StatusForbidden)
+			return
+		}
+
+		payload.Scopes = slices.Clone(claims.Permissions)
+	}
+
+	random, err := randomToken(32)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	key := apiKeyPrefix + random
+
+	apiKey := data.APIKey{
+		UserID:    user.ID,
+		Name:      payload.Name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   hashToken(key),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if apiKey.Scopes == nil {
+		apiKey.Scopes = []string{}
+	}
+
+	apiKey.ID, err = app.DB.InsertAPIKey(apiKey)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	apiKey.CreatedAt = time.Now()
+
+	_ = app.writeJSON(resp, http.StatusCreated, createdAPIKey{APIKey: apiKey, Key: key})
+}
+
+func (app *Application) revokeAPIKey(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	keyId, err := strconv.Atoi(chi.URLParam(req, "keyId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.DeleteAPIKey(user.ID, keyId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(resp, errors.New("API key not found"), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
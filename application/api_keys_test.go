@@ -0,0 +1,270 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_app_createAPIKey(t *testing.T) {
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1}
+	adminTokens, _ := app.generateTokenPair(&adminUser)
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	userTokens, _ := app.generateTokenPair(&testUser)
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	var tests = []struct {
+		name               string
+		token              string
+		requestBody        string
+		expectedStatusCode int
+	}{
+		{"no name", adminTokens.AccessToken, `{"name":" "}`, http.StatusBadRequest},
+		{"expired", adminTokens.AccessToken, `{"name":"backup","expires_at":"` + past + `"}`, http.StatusBadRequest},
+		{"scope the user lacks", userTokens.AccessToken, `{"name":"cleanup","scopes":["users:delete"]}`, http.StatusBadRequest},
+		{"unknown field", adminTokens.AccessToken, `{"name":"backup","key":"key_mine"}`, http.StatusBadRequest},
+		{"valid", adminTokens.AccessToken, `{"name":"backup"}`, http.StatusCreated},
+		{"valid with scopes", adminTokens.AccessToken, `{"name":"report","scopes":["users:read"]}`, http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/me/api-keys", strings.NewReader(test.requestBody))
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			resp := httptest.NewRecorder()
+
+			app.Routes().ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d: %s", test.name, test.expectedStatusCode, resp.Code, resp.Body)
+			}
+
+			if resp.Code != http.StatusCreated {
+				return
+			}
+
+			var created createdAPIKey
+			_ = json.NewDecoder(resp.Body).Decode(&created)
+
+			if !strings.HasPrefix(created.Key, apiKeyPrefix) || created.Prefix != created.Key[:apiKeyPrefixLength] {
+				t.Errorf("%s returned an unexpected key %q with prefix %q", test.name, created.Key, created.Prefix)
+			}
+
+			stored, err := app.DB.GetAPIKey(hashToken(created.Key))
+
+			if err != nil || stored.UserID != 1 {
+				t.Errorf("%s expected the key's hash to be stored for the user", test.name)
+			}
+		})
+	}
+}
+
+func Test_app_apiKeyAuthentication(t *testing.T) {
+	// keys look their user's roles up on each request, so the user has to be an admin in the database
+	keysApp := app
+	keysApp.DB = &dbrepo.TestDBRepo{}
+	_ = keysApp.DB.AssignRole(1, roleAdmin)
+
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	adminTokens, _ := keysApp.generateTokenPair(&adminUser)
+
+	mux := keysApp.Routes()
+
+	createKey := func(body string) createdAPIKey {
+		req, _ := http.NewRequest("POST", "/me/api-keys", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminTokens.AccessToken)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		var created createdAPIKey
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+
+		return created
+	}
+
+	fullKey := createKey(`{"name":"admin scripts"}`)
+	scopedKey := createKey(`{"name":"reporting","scopes":["users:read"]}`)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	_, _ = keysApp.DB.InsertAPIKey(data.APIKey{UserID: 1, Name: "old", Prefix: "key_expired", KeyHash: hashToken("key_expired"), ExpiresAt: &expiredAt})
+
+	var tests = []struct {
+		name               string
+		method             string
+		route              string
+		header             string
+		value              string
+		expectedStatusCode int
+	}{
+		{"X-API-Key header", "GET", "/me", "X-API-Key", fullKey.Key, http.StatusOK},
+		{"ApiKey scheme", "GET", "/me", "Authorization", "ApiKey " + fullKey.Key, http.StatusOK},
+		{"unknown key", "GET", "/me", "X-API-Key", apiKeyPrefix + "nope", http.StatusUnauthorized},
+		{"expired key", "GET", "/me", "X-API-Key", "key_expired", http.StatusUnauthorized},
+		{"key as a bearer token", "GET", "/me", "Authorization", "Bearer " + fullKey.Key, http.StatusUnauthorized},
+		{"full key has the user's permissions", "DELETE", "/admin/users/1/lockout", "X-API-Key", fullKey.Key, http.StatusNoContent},
+		{"scoped key within scope", "GET", "/users/", "X-API-Key", scopedKey.Key, http.StatusOK},
+		{"scoped key outside scope", "DELETE", "/admin/users/1/lockout", "X-API-Key", scopedKey.Key, http.StatusForbidden},
+		{"key creating a key", "POST", "/me/api-keys", "X-API-Key", fullKey.Key, http.StatusForbidden},
+		{"scoped key changing the account", "PATCH", "/me", "X-API-Key", scopedKey.Key, http.StatusForbidden},
+		{"full key changing the account", "PATCH", "/me", "X-API-Key", fullKey.Key, http.StatusForbidden},
+		{"key changing the password", "PUT", "/me/password", "X-API-Key", scopedKey.Key, http.StatusForbidden},
+		{"key turning off MFA", "DELETE", "/me/mfa", "X-API-Key", scopedKey.Key, http.StatusForbidden},
+		{"key ending a session", "DELETE", "/me/sessions/1", "X-API-Key", scopedKey.Key, http.StatusForbidden},
+		{"key listing sessions", "GET", "/me/sessions", "X-API-Key", scopedKey.Key, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, test.route, strings.NewReader(`{"name":"more"}`))
+			req.Header.Set(test.header, test.value)
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+}
+
+func Test_app_listAndRevokeAPIKeys(t *testing.T) {
+	keysApp := app
+	keysApp.DB = &dbrepo.TestDBRepo{}
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	tokens, _ := keysApp.generateTokenPair(&testUser)
+
+	otherKeyID, _ := keysApp.DB.InsertAPIKey(data.APIKey{UserID: 2, Name: "theirs", KeyHash: hashToken("key_theirs")})
+
+	mux := keysApp.Routes()
+
+	send := func(method, route, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	var created createdAPIKey
+	_ = json.NewDecoder(send("POST", "/me/api-keys", `{"name":"deploy"}`).Body).Decode(&created)
+
+	// use the key once, so it has a last used time
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-API-Key", created.Key)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	resp := send("GET", "/me/api-keys", "")
+
+	if strings.Contains(resp.Body.String(), created.Key) || strings.Contains(resp.Body.String(), hashToken(created.Key)) {
+		t.Fatalf("listing keys must not reveal the key or its hash")
+	}
+
+	var keys []data.APIKey
+	_ = json.NewDecoder(resp.Body).Decode(&keys)
+
+	if len(keys) != 1 || keys[0].Name != "deploy" || keys[0].Prefix != created.Prefix || keys[0].LastUsedAt == nil {
+		t.Fatalf("expected the caller's key with its last used time, got %+v", keys)
+	}
+
+	if resp := send("DELETE", fmt.Sprintf("/me/api-keys/%d", otherKeyID), ""); resp.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404 revoking another user's key, got %d", resp.Code)
+	}
+
+	if resp := send("DELETE", fmt.Sprintf("/me/api-keys/%d", created.ID), ""); resp.Code != http.StatusNoContent {
+		t.Errorf("expected status code 204 revoking a key, got %d", resp.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-API-Key", created.Key)
+	resp = httptest.NewRecorder()
+
+	mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked key to be rejected, got status code %d", resp.Code)
+	}
+}
+
+func Test_app_delegatedClientTokens(t *testing.T) {
+	clientApp := app
+	clientApp.DB = &dbrepo.TestDBRepo{}
+	_ = clientApp.DB.AssignRole(1, roleAdmin)
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	delegated, _ := clientApp.issueTokenPair(&testUser, "delegated", "reporting-app", permUsersRead)
+
+	mux := clientApp.Routes()
+
+	var tests = []struct {
+		name               string
+		method             string
+		route              string
+		requestBody        string
+		expectedStatusCode int
+	}{
+		{"reading the account", "GET", "/me", "", http.StatusOK},
+		{"creating an API key", "POST", "/me/api-keys", `{"name":"escape"}`, http.StatusForbidden},
+		{"changing the email address", "PATCH", "/me", `{"email":"attacker@example.com"}`, http.StatusForbidden},
+		{"changing the password", "PUT", "/me/password", `{"password":"new-password"}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, test.route, strings.NewReader(test.requestBody))
+			req.Header.Set("Authorization", "Bearer "+delegated.AccessToken)
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+
+	// the routes refuse such tokens, but createAPIKey also keeps a key made with one within its scope
+	create := func(permissions []string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/me/api-keys", strings.NewReader(`{"name":"report"}`))
+		req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, &Claims{
+			ClientID:         "reporting-app",
+			Permissions:      permissions,
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "1"},
+		}))
+		resp := httptest.NewRecorder()
+
+		http.HandlerFunc(clientApp.createAPIKey).ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := create([]string{permUsersRead})
+
+	var created createdAPIKey
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+
+	stored, err := clientApp.DB.GetAPIKey(hashToken(created.Key))
+
+	if resp.Code != http.StatusCreated || err != nil || !slices.Equal(stored.Scopes, []string{permUsersRead}) {
+		t.Errorf("expected a key limited to the token's permissions, got status code %d and %+v", resp.Code, stored)
+	}
+
+	if resp := create(nil); resp.Code != http.StatusForbidden {
+		t.Errorf("expected a token without permissions not to create a key, got status code %d", resp.Code)
+	}
+}
@@ -2,11 +2,31 @@ package application
 
 import (
 	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"time"
 )
 
 type Application struct {
 	Datasource string
 	DB         repository.DatabaseRepo
 	Domain     string
+	BaseURL    string
 	JWTSecret  string
+	Mailer     mailer.Mailer
+
+	// Keys signs and verifies tokens. It is built once at startup, from the configured key files or
+	// else from JWTSecret.
+	Keys *Keyring
+
+	// RequireVerifiedEmail stops users logging in until they have verified their email address
+	RequireVerifiedEmail bool
+
+	// MaxLoginFailures and MaxLoginFailuresPerIP are how many failed logins an email address or an
+	// IP address may have before it is locked out; zero turns the check off
+	MaxLoginFailures      int
+	MaxLoginFailuresPerIP int
+
+	// TokenLeeway is how far the exp, nbf and iat times of a token may be off when we check it, to
+	// allow for clock skew between servers
+	TokenLeeway time.Duration
 }
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -19,42 +21,134 @@ type TokenPairs struct {
 }
 
 type Claims struct {
-	Username string `json:"username"`
+	Username    string   `json:"username"`
+	Admin       bool     `json:"admin"`
+	SessionID   string   `json:"sid"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Type        string   `json:"typ,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	APIKeyID    int      `json:"-"`
+	Actor       *Actor   `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the act claim (RFC 8693) of an impersonation token, naming who is really making the
+// request
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// IsClient reports whether the token was issued to an OAuth client acting for itself, through the
+// client credentials grant, rather than to a user
+func (c *Claims) IsClient() bool {
+	return c.ClientID != "" && c.Subject == c.ClientID
+}
+
+var errRefreshTokenReused = errors.New("Refresh token has already been used")
+var errRefreshTokenRevoked = errors.New("Refresh token has been revoked")
+
+// generateTokenPair issues tokens for a fresh login, starting a new refresh token family
 func (app *Application) generateTokenPair(user *data.User) (TokenPairs, error) {
-	// create token
-	token := jwt.New(jwt.SigningMethodHS256)
+	familyID, err := randomToken(16)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	return app.issueTokenPair(user, familyID, "", "")
+}
+
+// issueTokenPair creates an access token and a refresh token for user, and stores a hash of the
+// refresh token as part of the given family. Tokens for an OAuth client only carry the user's
+// permissions which are in the scope the user granted it; the family keeps the client ID and scope,
+// so refreshing can't widen them or move the tokens to another client.
+func (app *Application) issueTokenPair(user *data.User, familyID, clientID, scope string) (TokenPairs, error) {
+	tokenID, err := randomToken(16)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	roles, permissions, err := app.userAuthorization(user)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	if clientID != "" {
+		scopes := strings.Fields(scope)
+
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+			return !slices.Contains(scopes, permission)
+		})
+	}
+
+	now := time.Now()
 
 	// set claims
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeAccess
+	claims["jti"] = tokenID
+	claims["sid"] = familyID
 	claims["name"] = fmt.Sprintf("%s %s", user.FirstName, user.LastName)
 	claims["sub"] = fmt.Sprint(user.ID)
 	claims["aud"] = app.Domain
 	claims["iss"] = app.Domain
-	claims["exp"] = time.Now().Add(jwtTokenExpiry).Unix()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(jwtTokenExpiry).Unix()
+	claims["roles"] = roles
+	claims["permissions"] = permissions
+	claims["admin"] = slices.Contains(roles, roleAdmin)
 
-	if user.IsAdmin == 1 {
-		claims["admin"] = true
-	} else {
-		claims["admin"] = false
+	if clientID != "" {
+		claims["client_id"] = clientID
+		claims["scope"] = scope
 	}
 
 	// create the signed token
-	signedAccessToken, err := token.SignedString([]byte(app.JWTSecret))
+	signedAccessToken, err := app.signToken(claims)
 
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
 	// create the refresh token
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshTokenClaims := refreshToken.Claims.(jwt.MapClaims)
+	refreshTokenClaims := jwt.MapClaims{}
+	refreshTokenExpires := now.Add(RefreshTokenExpiry)
+	refreshTokenID, err := randomToken(16)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	refreshTokenClaims["typ"] = tokenTypeRefresh
+	refreshTokenClaims["jti"] = refreshTokenID
 	refreshTokenClaims["sub"] = fmt.Sprint(user.ID)
-	refreshTokenClaims["exp"] = time.Now().Add(RefreshTokenExpiry).Unix()
+	refreshTokenClaims["aud"] = app.Domain
+	refreshTokenClaims["iss"] = app.Domain
+	refreshTokenClaims["iat"] = now.Unix()
+	refreshTokenClaims["nbf"] = now.Unix()
+	refreshTokenClaims["exp"] = refreshTokenExpires.Unix()
+
+	signedRefreshToken, err := app.signToken(refreshTokenClaims)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
 
-	signedRefreshToken, err := refreshToken.SignedString([]byte(app.JWTSecret))
+	// keep a record of the refresh token, so it can only be used once
+	_, err = app.DB.InsertRefreshToken(data.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		Scope:     scope,
+		TokenHash: hashToken(signedRefreshToken),
+		ExpiresAt: refreshTokenExpires,
+	})
 
 	if err != nil {
 		return TokenPairs{}, err
@@ -66,6 +160,43 @@ func (app *Application) generateTokenPair(user *data.User) (TokenPairs, error) {
 	}, nil
 }
 
+// rotateRefreshToken exchanges a refresh token for a new token pair in the same family. A token can
+// only be exchanged once; if a used token is presented again, we assume it was stolen and revoke
+// the whole family, which logs out both the thief and the legitimate user. clientID is the OAuth
+// client asking, or empty for our own login; a token only refreshes for the client it was issued to.
+func (app *Application) rotateRefreshToken(refreshToken string, user *data.User, clientID string) (TokenPairs, error) {
+	stored, err := app.DB.GetRefreshToken(hashToken(refreshToken))
+
+	if err != nil || stored.UserID != user.ID || stored.ClientID != clientID {
+		return TokenPairs{}, errors.New("Unknown refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		return TokenPairs{}, errRefreshTokenRevoked
+	}
+
+	if stored.UsedAt == nil {
+		err = app.DB.MarkRefreshTokenUsed(stored.ID)
+	}
+
+	if stored.UsedAt != nil || errors.Is(err, repository.ErrRefreshTokenUsed) {
+		_ = app.DB.RevokeRefreshTokenFamily(stored.FamilyID)
+		return TokenPairs{}, errRefreshTokenReused
+	}
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	err = app.DB.MarkSessionUsed(stored.FamilyID)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	return app.issueTokenPair(user, stored.FamilyID, stored.ClientID, stored.Scope)
+}
+
 func (app *Application) getTokenFromHeaderAndVerify(resp http.ResponseWriter, req *http.Request) (string, *Claims, error) {
 	// add a header
 	resp.Header().Add("Vary", "Authorization")
@@ -92,33 +223,76 @@ func (app *Application) getTokenFromHeaderAndVerify(resp http.ResponseWriter, re
 
 	token := headerParts[1]
 
-	// declare an empty Claims variable
-	claims := &Claims{}
+	claims, err := app.verifyAccessToken(token)
 
-	// parse the token with our claims (we read into claims), using our secret (from the receiver)
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
-		// validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
+	if err != nil {
+		return "", nil, err
+	}
 
-		return []byte(app.JWTSecret), nil
-	})
+	// token is valid
+	return token, claims, nil
+}
+
+// verifyAccessToken checks an access token is one we issued, has not expired and has not been
+// revoked, and returns its claims
+func (app *Application) verifyAccessToken(token string) (*Claims, error) {
+	claims, err := app.validateToken(token, tokenTypeAccess)
 
-	// check for an error; note that this catches expired tokens as well
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "token is expired by") {
-			return "", nil, errors.New("Token is expired")
+		return nil, err
+	}
+
+	// ensure the token hasn't been revoked by a logout
+	revoked, err := app.DB.IsAccessTokenRevoked(claims.ID, claims.SessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, errors.New("Token has been revoked")
+	}
+
+	return claims, nil
+}
+
+// revokePresentedTokens revokes the access token in the Authorization header and the refresh token
+// posted in the form or sent as a cookie, whichever of them are present and valid. Revoking a refresh
+// token revokes its whole family, which also invalidates every access token issued alongside it.
+func (app *Application) revokePresentedTokens(resp http.ResponseWriter, req *http.Request) error {
+	if req.Header.Get("Authorization") != "" {
+		_, claims, err := app.getTokenFromHeaderAndVerify(resp, req)
+
+		if err == nil {
+			err = app.DB.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+
+			if err != nil {
+				return err
+			}
+
+			err = app.DB.RevokeRefreshTokenFamily(claims.SessionID)
+
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		return "", nil, err
+	refreshToken := req.PostFormValue("refresh_token")
+
+	if refreshToken == "" {
+		if cookie, err := req.Cookie(refreshCookieName); err == nil {
+			refreshToken = cookie.Value
+		}
 	}
 
-	// ensure we issued the token
-	if claims.Issuer != app.Domain {
-		return "", nil, errors.New("Incorrect issuer")
+	if refreshToken != "" {
+		stored, err := app.DB.GetRefreshToken(hashToken(refreshToken))
+
+		if err == nil {
+			return app.DB.RevokeRefreshTokenFamily(stored.FamilyID)
+		}
 	}
 
-	// token is valid
-	return token, claims, nil
+	return nil
 }
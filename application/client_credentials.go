@@ -0,0 +1,109 @@
+package application
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var errInvalidClient = errors.New("Client authentication failed")
+
+// authenticateClient identifies the client calling the token endpoint, from HTTP Basic auth or the
+// client_id and client_secret form parameters. Confidential clients must give their secret. Public
+// clients can't keep one, so they only name themselves; their requests are tied to them some other
+// way, such as PKCE.
+func (app *Application) authenticateClient(req *http.Request) (*data.OAuthClient, error) {
+	clientID, secret, ok := req.BasicAuth()
+
+	if ok {
+		// RFC 6749 has clients form encode their credentials before putting them in the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+
+	client, err := app.DB.GetOAuthClient(clientID)
+
+	if err != nil {
+		return nil, errInvalidClient
+	}
+
+	if client.Confidential() {
+		if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return nil, errInvalidClient
+		}
+	} else if secret != "" {
+		return nil, errInvalidClient
+	}
+
+	return client, nil
+}
+
+func (app *Application) invalidClient(resp http.ResponseWriter) {
+	resp.Header().Set("WWW-Authenticate", `Basic realm="`+app.Domain+`"`)
+	app.oauthErrorJSON(resp, http.StatusUnauthorized, "invalid_client", errInvalidClient.Error())
+}
+
+// clientCredentialsGrant issues an access token to a confidential client acting for itself, such as
+// a backend service. There is no user, and no refresh token; the client just asks again.
+func (app *Application) clientCredentialsGrant(resp http.ResponseWriter, req *http.Request) {
+	client, err := app.authenticateClient(req)
+
+	if err != nil {
+		app.invalidClient(resp)
+		return
+	}
+
+	if !client.Confidential() {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "unauthorized_client", "Only confidential clients may use the client credentials grant")
+		return
+	}
+
+	scope, err := clientScope(client, req.PostForm.Get("scope"))
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	accessToken, err := app.issueClientToken(client, scope)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	app.writeOAuthTokens(resp, TokenPairs{AccessToken: accessToken}, scope, "")
+}
+
+// issueClientToken creates an access token for a client. Its subject is the client ID, and its
+// scope stands in for the permissions a user's roles would grant.
+func (app *Application) issueClientToken(client *data.OAuthClient, scope string) (string, error) {
+	tokenID, err := randomToken(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeAccess
+	claims["jti"] = tokenID
+	claims["sub"] = client.ClientID
+	claims["client_id"] = client.ClientID
+	claims["scope"] = scope
+	claims["aud"] = app.Domain
+	claims["iss"] = app.Domain
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(jwtTokenExpiry).Unix()
+
+	return app.signToken(claims)
+}
@@ -0,0 +1,122 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_clientCredentialsGrant(t *testing.T) {
+	var service registeredClient
+
+	registration := registerTestClientResponse(t, `{"name":"Reporting","scopes":["users:read","users:write"],"confidential":true}`)
+	_ = json.Unmarshal(registration, &service)
+
+	if service.ClientSecret == "" {
+		t.Fatalf("expected a client secret for a confidential client")
+	}
+
+	public := registerTestClient(t, `{"name":"SPA","redirect_uris":["https://app.example.com/callback"],"scopes":["users:read"]}`)
+
+	mux := app.Routes()
+
+	var tests = []struct {
+		name               string
+		clientID           string
+		secret             string
+		basicAuth          bool
+		scope              string
+		expectedStatusCode int
+		expectedScope      string
+	}{
+		{"basic auth", service.ClientID, service.ClientSecret, true, "", http.StatusOK, "users:read users:write"},
+		{"form credentials", service.ClientID, service.ClientSecret, false, "users:read", http.StatusOK, "users:read"},
+		{"wrong secret", service.ClientID, "wrong", true, "", http.StatusUnauthorized, ""},
+		{"no secret", service.ClientID, "", false, "", http.StatusUnauthorized, ""},
+		{"unknown client", "nope", "secret", true, "", http.StatusUnauthorized, ""},
+		{"public client", public.ClientID, "", false, "", http.StatusBadRequest, ""},
+		{"scope not allowed", service.ClientID, service.ClientSecret, true, "users:delete", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{"grant_type": {"client_credentials"}, "scope": {test.scope}}
+
+			if !test.basicAuth {
+				form.Set("client_id", test.clientID)
+				form.Set("client_secret", test.secret)
+			}
+
+			req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if test.basicAuth {
+				req.SetBasicAuth(test.clientID, test.secret)
+			}
+
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code == http.StatusUnauthorized && resp.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s expected a WWW-Authenticate header", test.name)
+			}
+
+			var tokenResponse oauthTokenResponse
+			_ = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+
+			if tokenResponse.Scope != test.expectedScope {
+				t.Errorf("%s expected scope %q, got %q", test.name, test.expectedScope, tokenResponse.Scope)
+			}
+
+			if resp.Code == http.StatusOK && tokenResponse.RefreshToken != "" {
+				t.Errorf("%s should not issue a refresh token", test.name)
+			}
+		})
+	}
+}
+
+func Test_app_machineTokenScopes(t *testing.T) {
+	var service registeredClient
+
+	_ = json.Unmarshal(registerTestClientResponse(t, `{"name":"Reporting","scopes":["users:read"],"confidential":true}`), &service)
+
+	client, _ := app.DB.GetOAuthClient(service.ClientID)
+	token, _ := app.issueClientToken(client, "users:read")
+
+	var tests = []struct {
+		name               string
+		method             string
+		route              string
+		expectedStatusCode int
+	}{
+		{"list users", "GET", "/users/", http.StatusOK},
+		{"get user", "GET", "/users/1", http.StatusOK},
+		{"delete user", "DELETE", "/users/1", http.StatusForbidden},
+		{"list roles", "GET", "/roles/", http.StatusForbidden},
+		{"me without a user", "GET", "/me/", http.StatusUnauthorized},
+	}
+
+	mux := app.Routes()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, test.route, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+}
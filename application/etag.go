@@ -0,0 +1,71 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"net/http"
+	"strings"
+)
+
+var errPreconditionFailed = errors.New("User has changed since you fetched them")
+
+// userETag identifies a version of a user. It changes whenever the user is updated.
+func userETag(user *data.User) string {
+	return fmt.Sprintf(`"%d-%d"`, user.ID, user.Version)
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag. If-Match compares
+// strongly, so weak validators never match; If-None-Match compares weakly.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch enforces the request's If-Match header, if it has one, against the user as we last
+// read them, writing 412 Precondition Failed and returning false when it doesn't match
+func (app *Application) checkIfMatch(resp http.ResponseWriter, req *http.Request, user *data.User) bool {
+	header := req.Header.Get("If-Match")
+
+	if header == "" || etagMatches(header, userETag(user), false) {
+		return true
+	}
+
+	resp.Header().Set("ETag", userETag(user))
+	app.errorJSON(resp, errPreconditionFailed, http.StatusPreconditionFailed)
+
+	return false
+}
+
+// writeVersionConflict responds to a user having changed between us reading and writing them. If
+// the client sent If-Match its precondition has now failed; otherwise there is a conflict to retry.
+func (app *Application) writeVersionConflict(resp http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("If-Match") != "" {
+		app.errorJSON(resp, errPreconditionFailed, http.StatusPreconditionFailed)
+		return
+	}
+
+	app.errorJSON(resp, errors.New("User was changed by someone else; please try again"), http.StatusConflict)
+}
+
+func isVersionConflict(err error) bool {
+	var conflict *repository.VersionConflictError
+
+	return errors.As(err, &conflict)
+}
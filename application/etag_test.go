@@ -0,0 +1,192 @@
+package application
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_etagMatches(t *testing.T) {
+	var tests = []struct {
+		name     string
+		header   string
+		weak     bool
+		expected bool
+	}{
+		{"same", `"1-2"`, false, true},
+		{"different", `"1-3"`, false, false},
+		{"one of a list", `"1-1", "1-2"`, false, true},
+		{"any", "*", false, true},
+		{"empty", "", false, false},
+		{"weak with strong comparison", `W/"1-2"`, false, false},
+		{"weak with weak comparison", `W/"1-2"`, true, true},
+	}
+
+	for _, test := range tests {
+		if etagMatches(test.header, `"1-2"`, test.weak) != test.expected {
+			t.Errorf("%s: expected %t", test.name, test.expected)
+		}
+	}
+}
+
+func Test_app_userETags(t *testing.T) {
+	etagApp := app
+	etagApp.DB = &dbrepo.TestDBRepo{}
+
+	send := func(method, userId string, headers map[string]string, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/users/"+userId, strings.NewReader(body))
+
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("userId", userId)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := send("GET", "1", nil, "", etagApp.getUser)
+	etag := resp.Header().Get("ETag")
+
+	if resp.Code != http.StatusOK || etag != `"1-1"` {
+		t.Fatalf("expected user 1 at version 1, got status %d and ETag %s", resp.Code, etag)
+	}
+
+	resp = send("GET", "1", map[string]string{"If-None-Match": etag}, "", etagApp.getUser)
+
+	if resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Errorf("expected 304 with no body for an unchanged user, got %d", resp.Code)
+	}
+
+	patch := map[string]string{"Content-Type": contentTypeMergePatch, "If-Match": etag}
+
+	resp = send("PATCH", "1", patch, `{"first_name":"Administrator"}`, etagApp.patchUser)
+
+	if resp.Code != http.StatusOK || resp.Header().Get("ETag") != `"1-2"` {
+		t.Fatalf("expected the patch to succeed with a new ETag, got %d and %s", resp.Code, resp.Header().Get("ETag"))
+	}
+
+	// the first admin's copy is now out of date
+	resp = send("PATCH", "1", patch, `{"first_name":"Someone else"}`, etagApp.patchUser)
+
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 patching a stale version, got %d", resp.Code)
+	}
+
+	resp = send("GET", "1", map[string]string{"If-None-Match": etag}, "", etagApp.getUser)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected 200 for a user who has changed, got %d", resp.Code)
+	}
+
+	resp = send("DELETE", "1", map[string]string{"If-Match": etag}, "", etagApp.deleteUser)
+
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 deleting a stale version, got %d", resp.Code)
+	}
+
+	resp = send("DELETE", "5", map[string]string{"If-Match": etag}, "", etagApp.deleteUser)
+
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting an unknown user, got %d", resp.Code)
+	}
+
+	resp = send("DELETE", "1", map[string]string{"If-Match": `"1-2"`}, "", etagApp.deleteUser)
+
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("expected 204 deleting the current version, got %d", resp.Code)
+	}
+}
+
+func Test_app_patchUserConcurrentChange(t *testing.T) {
+	etagApp := app
+	etagApp.DB = &dbrepo.TestDBRepo{}
+
+	user, _ := etagApp.DB.GetUser(1)
+
+	// someone else changes the user after we read them
+	_ = etagApp.DB.UpdateUser(*user)
+
+	err := etagApp.DB.UpdateUser(*user)
+
+	if !isVersionConflict(err) {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+
+	for _, ifMatch := range []string{"", `"1-1"`} {
+		req, _ := http.NewRequest("PATCH", "/", nil)
+
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		resp := httptest.NewRecorder()
+		etagApp.writeVersionConflict(resp, req)
+
+		expected := http.StatusConflict
+
+		if ifMatch != "" {
+			expected = http.StatusPreconditionFailed
+		}
+
+		if resp.Code != expected {
+			t.Errorf("If-Match %q: expected %d, got %d", ifMatch, expected, resp.Code)
+		}
+	}
+}
+
+func Test_app_roleChangeETag(t *testing.T) {
+	etagApp := app
+	etagApp.DB = &dbrepo.TestDBRepo{}
+
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1}
+	tokens, _ := etagApp.generateTokenPair(&adminUser)
+
+	mux := etagApp.Routes()
+
+	send := func(method, route, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	etag := send("GET", "/users/1", "").Header().Get("ETag")
+
+	// granting and removing admin change is_admin, so each must give the user a new ETag
+	changes := []struct {
+		method string
+		route  string
+		body   string
+	}{
+		{"POST", "/users/1/roles", `{"role":"admin"}`},
+		{"DELETE", "/users/1/roles/admin", ""},
+	}
+
+	for _, change := range changes {
+		if resp := send(change.method, change.route, change.body); resp.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s failed with status code %d", change.method, change.route, resp.Code)
+		}
+
+		changed := send("GET", "/users/1", "").Header().Get("ETag")
+
+		if changed == etag {
+			t.Errorf("expected %s %s to change the ETag from %s", change.method, change.route, etag)
+		}
+
+		etag = changed
+	}
+}
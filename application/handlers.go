@@ -1,13 +1,18 @@
 package application
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,10 +34,23 @@ func (app *Application) authenticate(resp http.ResponseWriter, req *http.Request
 		return
 	}
 
+	if errs := validateCredentials(creds); len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// refuse to even check the password while the account or IP address is locked out
+	if lockedUntil, locked := app.loginLockedUntil(creds.Username, req); locked {
+		resp.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		app.errorJSON(resp, errLoginLocked, http.StatusTooManyRequests)
+		return
+	}
+
 	// look up user by email address
 	user, err := app.DB.GetUserByEmail(creds.Username)
 
 	if err != nil {
+		app.recordLoginFailure(creds.Username, req)
 		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
 		return
 	}
@@ -40,13 +58,52 @@ func (app *Application) authenticate(resp http.ResponseWriter, req *http.Request
 	// check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 
+	if err != nil {
+		app.recordLoginFailure(creds.Username, req)
+		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	app.clearLoginFailures(creds.Username, req)
+
+	app.continueLogin(resp, req, user)
+}
+
+// continueLogin takes a user who has proved who they are with a password or a magic link. Users
+// with a second factor get a challenge to answer at /auth/mfa; everyone else gets tokens.
+func (app *Application) continueLogin(resp http.ResponseWriter, req *http.Request, user *data.User) {
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		app.errorJSON(resp, errors.New("Email address has not been verified"), http.StatusForbidden)
+		return
+	}
+
+	mfa, err := app.DB.GetMFA(user.ID)
+
 	if err != nil {
 		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
 		return
 	}
 
+	if mfa.ConfirmedAt != nil {
+		challenge, err := app.issueMFAChallenge(user)
+
+		if err != nil {
+			app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
+			return
+		}
+
+		_ = app.writeJSON(resp, http.StatusOK, mfaChallenge{MFARequired: true, MFAToken: challenge})
+		return
+	}
+
+	app.completeLogin(resp, req, user)
+}
+
+// completeLogin starts a session for a user who has proved who they are, and issues its tokens,
+// setting the refresh cookie
+func (app *Application) completeLogin(resp http.ResponseWriter, req *http.Request, user *data.User) {
 	// generate token
-	tokenPair, err := app.generateTokenPair(user)
+	tokenPair, err := app.startSession(req, user)
 
 	if err != nil {
 		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
@@ -79,11 +136,7 @@ func (app *Application) refresh(resp http.ResponseWriter, req *http.Request) {
 
 	refreshToken := req.Form.Get("refresh_token")
 
-	claims := &Claims{}
-
-	_, err = jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (any, error) {
-		return []byte(app.JWTSecret), nil
-	})
+	claims, err := app.validateToken(refreshToken, tokenTypeRefresh)
 
 	if err != nil {
 		app.errorJSON(resp, err, http.StatusBadRequest)
@@ -109,10 +162,10 @@ func (app *Application) refresh(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	tokenPair, err := app.generateTokenPair(user)
+	tokenPair, err := app.rotateRefreshToken(refreshToken, user, "")
 
 	if err != nil {
-		app.errorJSON(resp, err, http.StatusBadRequest)
+		app.errorJSON(resp, err, refreshErrorStatus(err))
 		return
 	}
 
@@ -134,12 +187,9 @@ func (app *Application) refresh(resp http.ResponseWriter, req *http.Request) {
 func (app *Application) refreshUsingCookie(resp http.ResponseWriter, req *http.Request) {
 	for _, cookie := range req.Cookies() {
 		if cookie.Name == refreshCookieName {
-			claims := &Claims{}
 			refreshToken := cookie.Value
 
-			_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (any, error) {
-				return []byte(app.JWTSecret), nil
-			})
+			claims, err := app.validateToken(refreshToken, tokenTypeRefresh)
 
 			if err != nil {
 				app.errorJSON(resp, err, http.StatusBadRequest)
@@ -165,10 +215,10 @@ func (app *Application) refreshUsingCookie(resp http.ResponseWriter, req *http.R
 				return
 			}
 
-			tokenPair, err := app.generateTokenPair(user)
+			tokenPair, err := app.rotateRefreshToken(refreshToken, user, "")
 
 			if err != nil {
-				app.errorJSON(resp, err, http.StatusBadRequest)
+				app.errorJSON(resp, err, refreshErrorStatus(err))
 				return
 			}
 
@@ -193,15 +243,94 @@ func (app *Application) refreshUsingCookie(resp http.ResponseWriter, req *http.R
 	app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
 }
 
+// refreshErrorStatus picks the status code for a failed refresh token rotation
+func refreshErrorStatus(err error) int {
+	if errors.Is(err, errRefreshTokenReused) || errors.Is(err, errRefreshTokenRevoked) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusBadRequest
+}
+
+// allUsers lists users a page at a time. Clients can filter by email, is_admin and created_after,
+// and sort by any of repository.UserSortColumns, prefixed with - to sort in descending order.
 func (app *Application) allUsers(resp http.ResponseWriter, req *http.Request) {
-	users, err := app.DB.AllUsers()
+	page, limit, err := readPage(req.URL.Query())
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	opts, err := userListOptions(req.URL.Query())
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit
+
+	users, total, err := app.DB.ListUsers(opts)
 
 	if err != nil {
 		app.errorJSON(resp, err, http.StatusInternalServerError)
 		return
 	}
 
-	_ = app.writeJSON(resp, http.StatusOK, users)
+	if users == nil {
+		users = []*data.User{}
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, usersPage[*data.User]{
+		Users: users,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+		Links: app.pageLinks(req, page, limit, total),
+	})
+}
+
+// userListOptions reads the sort and filter query parameters for listing users
+func userListOptions(query url.Values) (repository.UserListOptions, error) {
+	var opts repository.UserListOptions
+
+	if sort := query.Get("sort"); sort != "" {
+		opts.Sort, opts.Descending = strings.CutPrefix(sort, "-")
+
+		if !slices.Contains(repository.UserSortColumns, opts.Sort) {
+			return opts, fmt.Errorf("Cannot sort by %s; use one of %s", opts.Sort, strings.Join(repository.UserSortColumns, ", "))
+		}
+	}
+
+	opts.Email = query.Get("email")
+
+	if value := query.Get("is_admin"); value != "" {
+		isAdmin, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return opts, errors.New("is_admin must be true or false")
+		}
+
+		opts.IsAdmin = &isAdmin
+	}
+
+	if value := query.Get("created_after"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+
+		if err != nil {
+			createdAfter, err = time.Parse(time.DateOnly, value)
+		}
+
+		if err != nil {
+			return opts, errors.New("created_after must be a date or an RFC 3339 time")
+		}
+
+		opts.CreatedAfter = &createdAfter
+	}
+
+	return opts, nil
 }
 
 func (app *Application) getUser(resp http.ResponseWriter, req *http.Request) {
@@ -219,9 +348,19 @@ func (app *Application) getUser(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	etag := userETag(user)
+	resp.Header().Set("ETag", etag)
+
+	if etagMatches(req.Header.Get("If-None-Match"), etag, true) {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	_ = app.writeJSON(resp, http.StatusOK, user)
 }
 
+// updateUser replaces all of a user's editable fields with those in the request. To change only
+// some of them, use patchUser.
 func (app *Application) updateUser(resp http.ResponseWriter, req *http.Request) {
 	var user data.User
 
@@ -232,6 +371,28 @@ func (app *Application) updateUser(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if errs := validateUser(&user); len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	previous, err := app.DB.GetUser(user.ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(resp, errors.New("User not found"), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if user.IsAdmin != previous.IsAdmin && !canSetAdmin(req) {
+		app.errorJSON(resp, errSetAdminForbidden, http.StatusForbidden)
+		return
+	}
+
 	err = app.DB.UpdateUser(user)
 
 	if err != nil {
@@ -239,6 +400,8 @@ func (app *Application) updateUser(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	app.sendVerificationEmailIfChanged(previous, &user)
+
 	resp.WriteHeader(http.StatusNoContent)
 }
 
@@ -250,6 +413,11 @@ func (app *Application) deleteUser(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if req.Header.Get("If-Match") != "" {
+		app.deleteUserIfMatch(resp, req, userId)
+		return
+	}
+
 	err = app.DB.DeleteUser(userId)
 
 	if err != nil {
@@ -260,26 +428,112 @@ func (app *Application) deleteUser(resp http.ResponseWriter, req *http.Request)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
+// deleteUserIfMatch deletes a user only if they are still the version the client's If-Match names
+func (app *Application) deleteUserIfMatch(resp http.ResponseWriter, req *http.Request, userId int) {
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("User not found"), http.StatusNotFound)
+		return
+	}
+
+	if !app.checkIfMatch(resp, req, user) {
+		return
+	}
+
+	err = app.DB.DeleteUserAtVersion(userId, user.Version)
+
+	if isVersionConflict(err) {
+		app.writeVersionConflict(resp, req)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// newUser is the payload for creating a user: the user, along with their password
+type newUser struct {
+	data.User
+	Password string `json:"password"`
+}
+
+// createUser creates a user, if their details are valid and no one else has their email address
 func (app *Application) createUser(resp http.ResponseWriter, req *http.Request) {
-	var user data.User
+	var payload newUser
 
-	err := app.readJSON(resp, req, &user)
+	err := app.readJSON(resp, req, &payload)
 
 	if err != nil {
 		app.errorJSON(resp, err, http.StatusBadRequest)
 		return
 	}
 
-	_, err = app.DB.InsertUser(user)
+	user := payload.User
+	user.Password = payload.Password
+
+	errs := validateUser(&user)
+	validatePassword(&errs, "password", payload.Password)
+
+	if _, err := app.DB.GetUserByEmail(user.Email); err == nil && len(errs.only("email")) == 0 {
+		errs.add("email", "is already in use")
+	}
+
+	if len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if user.IsAdmin != 0 && !canSetAdmin(req) {
+		app.errorJSON(resp, errSetAdminForbidden, http.StatusForbidden)
+		return
+	}
+
+	user.ID, err = app.DB.InsertUser(user)
 
 	if err != nil {
 		app.errorJSON(resp, err, http.StatusInternalServerError)
 		return
 	}
 
+	app.sendVerificationEmailIfChanged(nil, &user)
+
 	_ = app.writeJSON(resp, http.StatusCreated, user)
 }
 
+func (app *Application) logout(resp http.ResponseWriter, req *http.Request) {
+	err := app.revokePresentedTokens(resp, req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.deleteRefreshCookie(resp, req)
+}
+
+func (app *Application) revokeUserSessions(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.RevokeUserRefreshTokens(userId)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
 func (app *Application) deleteRefreshCookie(resp http.ResponseWriter, req *http.Request) {
 	http.SetCookie(resp, &http.Cookie{
 		Name:     refreshCookieName,
@@ -2,6 +2,8 @@ package application
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/spartanhooah/testing-rest-api/data"
 	"net/http"
@@ -20,9 +22,9 @@ func Test_app_authenticate(t *testing.T) {
 	}{
 		{"valid user", `{"email":"admin@example.com","password":"secret"}`, http.StatusOK},
 		{"not JSON", `I'm not JSON'`, http.StatusUnauthorized},
-		{"empty JSON", `{}`, http.StatusUnauthorized},
-		{"empty email", `{"email":"","password":"secret"}`, http.StatusUnauthorized},
-		{"empty password", `{"email":"admin@example.com","password":""}`, http.StatusUnauthorized},
+		{"empty JSON", `{}`, http.StatusUnprocessableEntity},
+		{"empty email", `{"email":"","password":"secret"}`, http.StatusUnprocessableEntity},
+		{"empty password", `{"email":"admin@example.com","password":""}`, http.StatusUnprocessableEntity},
 		{"invalid user", `{"email":"admin@otherdomain.com","password":"secret"}`, http.StatusUnauthorized},
 	}
 
@@ -99,6 +101,65 @@ func Test_app_refresh(t *testing.T) {
 	}
 }
 
+func Test_app_refreshTokenReuse(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	oldRefreshTime := RefreshTokenExpiry
+	RefreshTokenExpiry = time.Second * 1
+	defer func() { RefreshTokenExpiry = oldRefreshTime }()
+
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	postRefresh := func(token string) *httptest.ResponseRecorder {
+		postedData := url.Values{
+			"refresh_token": {token},
+		}
+
+		req, _ := http.NewRequest("POST", "/refresh-token", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.refresh)
+
+		handler.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	// the first use rotates the token
+	resp := postRefresh(tokens.RefreshToken)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("first refresh expected status code %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var rotated TokenPairs
+	_ = json.NewDecoder(resp.Body).Decode(&rotated)
+
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Errorf("refresh token was not rotated")
+	}
+
+	// presenting the old token again is treated as theft
+	resp = postRefresh(tokens.RefreshToken)
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("reused token expected status code %d, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// and the token handed out by the first refresh is revoked along with the rest of its family
+	resp = postRefresh(rotated.RefreshToken)
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("rotated token from revoked family expected status code %d, got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
+
 func Test_app_usersCRUD(t *testing.T) {
 	var tests = []struct {
 		name               string
@@ -141,7 +202,7 @@ func Test_app_usersCRUD(t *testing.T) {
 		{
 			"insert user valid",
 			"PUT",
-			`{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`,
+			`{"first_name":"Jack","last_name":"Smith","email":"jack@example.com","password":"a good password"}`,
 			"",
 			app.createUser,
 			http.StatusCreated,
@@ -192,6 +253,92 @@ func Test_app_usersCRUD(t *testing.T) {
 	}
 }
 
+func Test_app_allUsers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedIDs        []int
+		expectedTotal      int
+		expectedNext       string
+		expectedPrev       string
+	}{
+		{"default", "", http.StatusOK, []int{5, 4, 2, 3, 1}, 5, "", ""},
+		{"first page", "?limit=2", http.StatusOK, []int{5, 4}, 5, "/users?limit=2&page=2", ""},
+		{"middle page", "?limit=2&page=2", http.StatusOK, []int{2, 3}, 5, "/users?limit=2&page=3", "/users?limit=2&page=1"},
+		{"last page", "?limit=2&page=3", http.StatusOK, []int{1}, 5, "", "/users?limit=2&page=2"},
+		{"past the end", "?limit=2&page=9", http.StatusOK, []int{}, 5, "", "/users?limit=2&page=3"},
+		{"sort descending", "?sort=-created_at", http.StatusOK, []int{5, 4, 3, 2, 1}, 5, "", ""},
+		{"sort by email", "?sort=email", http.StatusOK, []int{1, 4, 5, 2, 3}, 5, "", ""},
+		{"admins", "?is_admin=true", http.StatusOK, []int{4, 1}, 2, "", ""},
+		{"email ignores case", "?email=JACK@smith.com", http.StatusOK, []int{2}, 1, "", ""},
+		{"created after", "?created_after=2024-03-01&sort=id", http.StatusOK, []int{4, 5}, 2, "", ""},
+		{
+			"filters kept in links",
+			"?is_admin=false&limit=1",
+			http.StatusOK,
+			[]int{5},
+			3,
+			"/users?is_admin=false&limit=1&page=2",
+			"",
+		},
+		{"bad page", "?page=0", http.StatusBadRequest, nil, 0, "", ""},
+		{"page too far", "?page=9223372036854775807", http.StatusBadRequest, nil, 0, "", ""},
+		{"limit too big", "?limit=1000", http.StatusBadRequest, nil, 0, "", ""},
+		{"unknown sort column", "?sort=password", http.StatusBadRequest, nil, 0, "", ""},
+		{"bad is_admin", "?is_admin=maybe", http.StatusBadRequest, nil, 0, "", ""},
+		{"bad created_after", "?created_after=yesterday", http.StatusBadRequest, nil, 0, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users"+test.query, nil)
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.allUsers).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var page usersPage[*data.User]
+			_ = json.NewDecoder(resp.Body).Decode(&page)
+
+			ids := []int{}
+
+			for _, user := range page.Users {
+				ids = append(ids, user.ID)
+			}
+
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIDs) {
+				t.Errorf("%s expected users %v, got %v", test.name, test.expectedIDs, ids)
+			}
+
+			if page.Total != test.expectedTotal {
+				t.Errorf("%s expected total %d, got %d", test.name, test.expectedTotal, page.Total)
+			}
+
+			expectedNext, expectedPrev := test.expectedNext, test.expectedPrev
+
+			if expectedNext != "" {
+				expectedNext = app.BaseURL + expectedNext
+			}
+
+			if expectedPrev != "" {
+				expectedPrev = app.BaseURL + expectedPrev
+			}
+
+			if page.Links.Next != expectedNext || page.Links.Prev != expectedPrev {
+				t.Errorf("%s expected links %s and %s, got %+v", test.name, expectedNext, expectedPrev, page.Links)
+			}
+		})
+	}
+}
+
 func Test_app_refreshUsingCookie(t *testing.T) {
 	testUser := data.User{
 		ID:        1,
@@ -284,3 +431,102 @@ func Test_app_deleteRefreshCookie(t *testing.T) {
 		t.Errorf("refresh cookie not found")
 	}
 }
+
+func Test_app_logout(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	postedData := url.Values{
+		"refresh_token": {tokens.RefreshToken},
+	}
+
+	req, _ := http.NewRequest("POST", "/logout", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.logout)
+
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusAccepted {
+		t.Errorf("wrong status; expected %d, got %d", http.StatusAccepted, resp.Code)
+	}
+
+	// the access token should no longer be accepted
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	_, _, err := app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+	if err == nil {
+		t.Errorf("access token should have been revoked")
+	}
+
+	// and neither should the refresh token
+	user, _ := app.DB.GetUser(1)
+
+	_, err = app.rotateRefreshToken(tokens.RefreshToken, user, "")
+
+	if err == nil {
+		t.Errorf("refresh token should have been revoked")
+	}
+}
+
+func Test_app_revokeUserSessions(t *testing.T) {
+	regularUser := data.User{
+		ID:        2,
+		FirstName: "Jack",
+		LastName:  "Smith",
+		Email:     "jack@example.com",
+	}
+
+	var tests = []struct {
+		name               string
+		idParam            string
+		expectedStatusCode int
+	}{
+		{"bad URL param", "x", http.StatusBadRequest},
+		{"valid user", "2", http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userTokens, _ := app.generateTokenPair(&regularUser)
+
+			req, _ := http.NewRequest("DELETE", "/", nil)
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userId", test.idParam)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+			resp := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.revokeUserSessions)
+
+			handler.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			// the user's access token only stops working if the sessions were revoked
+			req, _ = http.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+userTokens.AccessToken)
+
+			_, _, err := app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+			if resp.Code == http.StatusNoContent && err == nil {
+				t.Errorf("%s: user's access token should have been revoked", test.name)
+			}
+
+			if resp.Code != http.StatusNoContent && err != nil {
+				t.Errorf("%s: user's access token should still be valid, got %s", test.name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// impersonation tokens can't be refreshed; support staff ask for a new one when it runs out
+var impersonationExpiry = time.Minute * 10
+
+var errImpersonating = errors.New("Not allowed while impersonating a user")
+
+type impersonationResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// impersonate issues a token which lets an admin use the API as another user. The admin can only
+// impersonate users whose permissions they have themselves, so impersonating can't be used to gain
+// permissions.
+func (app *Application) impersonate(resp http.ResponseWriter, req *http.Request) {
+	claims, _ := claimsFromContext(req.Context())
+
+	actorID, err := strconv.Atoi(claims.Subject)
+
+	if err != nil || claims.IsClient() {
+		app.errorJSON(resp, errors.New("Only users can impersonate other users"), http.StatusForbidden)
+		return
+	}
+
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	if userId == actorID {
+		app.errorJSON(resp, errors.New("You cannot impersonate yourself"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("User not found"), http.StatusNotFound)
+		return
+	}
+
+	_, permissions, err := app.userAuthorization(user)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, permission := range permissions {
+		if !claims.HasPermission(permission) {
+			app.errorJSON(resp, errors.New("Cannot impersonate a user with permissions you don't have"), http.StatusForbidden)
+			return
+		}
+	}
+
+	token, err := app.issueImpersonationToken(req, user, claims.Subject)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	// don't hand out a token we couldn't record handing out
+	err = app.audit(req, actorID, user.ID, "impersonate", http.StatusOK)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(resp, http.StatusOK, impersonationResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(impersonationExpiry.Seconds()),
+	})
+}
+
+// issueImpersonationToken creates an access token for user, with the user's roles and permissions,
+// and an act claim naming the admin behind it. There is no refresh token, but the token starts a
+// session of the user's, so ending that session or all of the user's sessions revokes it early.
+func (app *Application) issueImpersonationToken(req *http.Request, user *data.User, actor string) (string, error) {
+	tokenID, err := randomToken(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	familyID, err := randomToken(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	roles, permissions, err := app.userAuthorization(user)
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeAccess
+	claims["jti"] = tokenID
+	claims["name"] = fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+	claims["sub"] = fmt.Sprint(user.ID)
+	claims["act"] = Actor{Subject: actor}
+	claims["aud"] = app.Domain
+	claims["iss"] = app.Domain
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(impersonationExpiry).Unix()
+	claims["roles"] = roles
+	claims["permissions"] = permissions
+	claims["admin"] = slices.Contains(roles, roleAdmin)
+	claims["sid"] = familyID
+
+	// access tokens are revoked along with their refresh token family, so give the session a family
+	// to revoke. Its one row is keyed by the jti, not a token anyone holds, so it can't be refreshed.
+	_, err = app.DB.InsertRefreshToken(data.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(tokenID),
+		ExpiresAt: now.Add(impersonationExpiry),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = app.DB.InsertSession(data.Session{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		UserAgent: "Impersonation by user " + actor,
+		IPAddress: clientIP(req),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return app.signToken(claims)
+}
+
+// serveImpersonated serves a request made with an impersonation token, then writes it to the audit
+// log along with the admin who made it and the status it got
+func (app *Application) serveImpersonated(next http.Handler, resp http.ResponseWriter, req *http.Request, claims *Claims) {
+	ww := middleware.NewWrapResponseWriter(resp, req.ProtoMajor)
+
+	next.ServeHTTP(ww, req)
+
+	status := ww.Status()
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	actorID, _ := strconv.Atoi(claims.Actor.Subject)
+	userID, _ := strconv.Atoi(claims.Subject)
+
+	err := app.audit(req, actorID, userID, req.Method+" "+req.URL.Path, status)
+
+	if err != nil {
+		log.Println("Error writing audit log:", err)
+	}
+}
+
+// denyImpersonation blocks requests made with an impersonation token. It guards the things only
+// the user themselves should do, like changing their password. It must run after authRequired.
+func (app *Application) denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		claims, ok := claimsFromContext(req.Context())
+
+		if !ok || claims.Actor != nil {
+			app.errorJSON(resp, errImpersonating, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+func (app *Application) audit(req *http.Request, actorID, userID int, action string, status int) error {
+	_, err := app.DB.InsertAuditEvent(data.AuditEvent{
+		ActorID:   actorID,
+		UserID:    userID,
+		Action:    action,
+		Status:    status,
+		IPAddress: clientIP(req),
+	})
+
+	return err
+}
+
+// userAuditLog lists what has been done as a user, newest first
+func (app *Application) userAuditLog(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := app.DB.GetUserAuditEvents(userId)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if events == nil {
+		events = []*data.AuditEvent{}
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, events)
+}
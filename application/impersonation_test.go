@@ -0,0 +1,207 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_app_impersonate(t *testing.T) {
+	impersonationApp := app
+	impersonationApp.DB = &dbrepo.TestDBRepo{}
+
+	mux := impersonationApp.Routes()
+
+	adminUser := data.User{ID: 2, FirstName: "Support", LastName: "Admin", Email: "support@example.com", IsAdmin: 1}
+	adminTokens, _ := impersonationApp.generateTokenPair(&adminUser)
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	userTokens, _ := impersonationApp.generateTokenPair(&testUser)
+
+	send := func(method, route, token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	var tests = []struct {
+		name               string
+		route              string
+		token              string
+		expectedStatusCode int
+	}{
+		{"not an admin", "/admin/impersonate/1", userTokens.AccessToken, http.StatusForbidden},
+		{"themselves", "/admin/impersonate/2", adminTokens.AccessToken, http.StatusBadRequest},
+		{"unknown user", "/admin/impersonate/99", adminTokens.AccessToken, http.StatusNotFound},
+		{"valid", "/admin/impersonate/1", adminTokens.AccessToken, http.StatusOK},
+	}
+
+	var impersonation impersonationResponse
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := send("POST", test.route, test.token, "")
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code == http.StatusOK {
+				_ = json.NewDecoder(resp.Body).Decode(&impersonation)
+			}
+		})
+	}
+
+	claims, err := impersonationApp.verifyAccessToken(impersonation.AccessToken)
+
+	if err != nil {
+		t.Fatalf("impersonation token did not verify: %s", err)
+	}
+
+	if claims.Subject != "1" || claims.Actor == nil || claims.Actor.Subject != "2" {
+		t.Errorf("expected a token for user 1 acting as admin 2, got sub %s and act %+v", claims.Subject, claims.Actor)
+	}
+
+	if time.Until(claims.ExpiresAt.Time) > impersonationExpiry {
+		t.Errorf("expected the token to expire within %s", impersonationExpiry)
+	}
+
+	// the admin sees what the user sees, but can't change how the user logs in
+	var requests = []struct {
+		method             string
+		route              string
+		body               string
+		expectedStatusCode int
+	}{
+		{"GET", "/me", "", http.StatusOK},
+		{"PUT", "/me/password", `{"current_password":"secret","new_password":"a new password"}`, http.StatusForbidden},
+		{"PATCH", "/me", `{"email":"attacker@example.com"}`, http.StatusForbidden},
+		{"POST", "/me/mfa", "", http.StatusForbidden},
+		{"DELETE", "/me/sessions/1", "", http.StatusForbidden},
+		{"POST", "/oauth/authorize", "", http.StatusForbidden},
+		{"POST", "/me/api-keys", `{"name":"backdoor"}`, http.StatusForbidden},
+	}
+
+	for _, request := range requests {
+		resp := send(request.method, request.route, impersonation.AccessToken, request.body)
+
+		if request.expectedStatusCode != resp.Code {
+			t.Errorf("%s %s expected status code %d, got %d", request.method, request.route, request.expectedStatusCode, resp.Code)
+		}
+	}
+
+	resp := send("GET", "/admin/users/1/audit-log", adminTokens.AccessToken, "")
+
+	var events []data.AuditEvent
+	_ = json.NewDecoder(resp.Body).Decode(&events)
+
+	if len(events) != len(requests)+1 {
+		t.Fatalf("expected the impersonation and each request to be audited, got %+v", events)
+	}
+
+	// newest first
+	if events[len(events)-1].Action != "impersonate" || events[0].Action != "POST /me/api-keys" || events[0].Status != http.StatusForbidden {
+		t.Errorf("unexpected audit log: %+v", events)
+	}
+
+	for _, event := range events {
+		if event.ActorID != 2 || event.UserID != 1 {
+			t.Errorf("expected admin 2 acting as user 1 to be recorded, got %+v", event)
+		}
+	}
+}
+
+func Test_app_impersonateWithoutTheirPermissions(t *testing.T) {
+	impersonationApp := app
+	impersonationApp.DB = &dbrepo.TestDBRepo{}
+	_ = impersonationApp.DB.AssignRole(1, roleAdmin)
+
+	// support staff who may impersonate users, but aren't admins themselves
+	token, _ := impersonationApp.signToken(jwt.MapClaims{
+		"typ":         tokenTypeAccess,
+		"sub":         "3",
+		"aud":         app.Domain,
+		"iss":         app.Domain,
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"permissions": []string{permImpersonate, permUsersRead},
+	})
+
+	req, _ := http.NewRequest("POST", "/admin/impersonate/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+
+	impersonationApp.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected status code 403 impersonating an admin, got %d", resp.Code)
+	}
+}
+
+func Test_app_endImpersonation(t *testing.T) {
+	impersonationApp := app
+	impersonationApp.DB = &dbrepo.TestDBRepo{}
+
+	mux := impersonationApp.Routes()
+
+	adminUser := data.User{ID: 2, FirstName: "Support", LastName: "Admin", Email: "support@example.com", IsAdmin: 1}
+	adminTokens, _ := impersonationApp.generateTokenPair(&adminUser)
+
+	send := func(method, route, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	impersonate := func() string {
+		var impersonation impersonationResponse
+		_ = json.NewDecoder(send("POST", "/admin/impersonate/1", adminTokens.AccessToken).Body).Decode(&impersonation)
+
+		return impersonation.AccessToken
+	}
+
+	first := impersonate()
+	second := impersonate()
+
+	var sessions []data.Session
+	_ = json.NewDecoder(send("GET", "/admin/users/1/sessions", adminTokens.AccessToken).Body).Decode(&sessions)
+
+	if len(sessions) != 2 || sessions[0].UserAgent != "Impersonation by user 2" {
+		t.Fatalf("expected each impersonation to be one of the user's sessions, got %+v", sessions)
+	}
+
+	// newest first, so the second session belongs to the first token
+	if resp := send("DELETE", fmt.Sprintf("/admin/users/1/sessions/%d", sessions[1].ID), adminTokens.AccessToken); resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status code 204 ending the session, got %d", resp.Code)
+	}
+
+	if resp := send("GET", "/me", first); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token to be revoked with its session, got status code %d", resp.Code)
+	}
+
+	if resp := send("GET", "/me", second); resp.Code != http.StatusOK {
+		t.Errorf("expected the other impersonation to continue, got status code %d", resp.Code)
+	}
+
+	if resp := send("DELETE", "/admin/users/1/sessions", adminTokens.AccessToken); resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status code 204 ending the user's sessions, got %d", resp.Code)
+	}
+
+	if resp := send("GET", "/me", second); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token to be revoked with the user's sessions, got status code %d", resp.Code)
+	}
+}
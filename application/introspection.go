@@ -0,0 +1,148 @@
+package application
+
+import (
+	"net/http"
+	"time"
+)
+
+// introspectionResponse describes a token, as RFC 7662 defines. Tokens which aren't active are
+// described only by active being false, so callers learn nothing else about them.
+type introspectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// introspectToken describes an access token or a refresh token. Access tokens go through the same
+// checks as a Bearer token sent to the API, including the denylist; refresh tokens are active
+// until they are used, revoked or expire. The two can't be confused, so the token_type_hint a
+// caller may send isn't needed.
+func (app *Application) introspectToken(token string) introspectionResponse {
+	if claims, err := app.verifyAccessToken(token); err == nil {
+		description := introspectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			TokenType: "Bearer",
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+			Roles:     claims.Roles,
+		}
+
+		if claims.ExpiresAt != nil {
+			description.Exp = claims.ExpiresAt.Unix()
+		}
+
+		if claims.IssuedAt != nil {
+			description.Iat = claims.IssuedAt.Unix()
+		}
+
+		return description
+	}
+
+	claims, err := app.validateToken(token, tokenTypeRefresh)
+
+	if err != nil {
+		return introspectionResponse{}
+	}
+
+	stored, err := app.DB.GetRefreshToken(hashToken(token))
+
+	if err != nil || stored.UsedAt != nil || stored.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+		return introspectionResponse{}
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Sub:       claims.Subject,
+		Exp:       stored.ExpiresAt.Unix(),
+		Jti:       claims.ID,
+	}
+}
+
+// introspect lets resource servers and gateways ask whether a token is active, rather than
+// verifying it themselves. Only confidential clients may ask, since the answer describes tokens
+// issued to other people.
+func (app *Application) introspect(resp http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", "Could not parse form")
+		return
+	}
+
+	client, err := app.authenticateClient(req)
+
+	if err != nil || !client.Confidential() {
+		app.invalidClient(resp)
+		return
+	}
+
+	token := req.PostForm.Get("token")
+
+	if token == "" {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(resp, http.StatusOK, app.introspectToken(token))
+}
+
+// revokeToken revokes an access token or a refresh token, as RFC 7009 defines. Revoking a refresh
+// token revokes its whole family, which includes the access tokens issued alongside it. A client
+// may only revoke tokens issued to it; others, like unknown or already invalid tokens, are left
+// alone without an error, so the response doesn't tell the caller which tokens exist.
+func (app *Application) revokeToken(resp http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", "Could not parse form")
+		return
+	}
+
+	client, err := app.authenticateClient(req)
+
+	if err != nil {
+		app.invalidClient(resp)
+		return
+	}
+
+	token := req.PostForm.Get("token")
+
+	if token == "" {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	err = nil
+
+	if claims, verifyErr := app.verifyAccessToken(token); verifyErr == nil {
+		if claims.ClientID != "" && claims.ClientID == client.ClientID {
+			err = app.DB.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+		}
+	} else if stored, lookupErr := app.DB.GetRefreshToken(hashToken(token)); lookupErr == nil {
+		if stored.ClientID != "" && stored.ClientID == client.ClientID {
+			err = app.DB.RevokeRefreshTokenFamily(stored.FamilyID)
+		}
+	}
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusInternalServerError, "server_error", "Could not revoke token")
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,170 @@
+package application
+
+import (
+	"encoding/json"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// oauthClientRequest posts a form to an OAuth endpoint, authenticating as clientID with HTTP Basic
+// auth if a secret is given, or naming the client in the form if not
+func oauthClientRequest(route, clientID, secret string, form url.Values) *httptest.ResponseRecorder {
+	if secret == "" && clientID != "" {
+		form.Set("client_id", clientID)
+	}
+
+	req, _ := http.NewRequest("POST", route, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+
+	resp := httptest.NewRecorder()
+	app.Routes().ServeHTTP(resp, req)
+
+	return resp
+}
+
+func Test_app_introspect(t *testing.T) {
+	var gateway registeredClient
+	_ = json.Unmarshal(registerTestClientResponse(t, `{"name":"Gateway","confidential":true}`), &gateway)
+
+	public := registerTestClient(t, `{"name":"SPA","redirect_uris":["https://app.example.com/callback"]}`)
+
+	service := registerTestClient(t, `{"name":"Reporting","scopes":["users:read"],"confidential":true}`)
+	machineToken, _ := app.issueClientToken(&service, "users:read")
+
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1}
+	tokens, _ := app.generateTokenPair(&adminUser)
+
+	var tests = []struct {
+		name               string
+		clientID           string
+		secret             string
+		token              string
+		expectedStatusCode int
+		expected           introspectionResponse
+	}{
+		{"no client", "", "", tokens.AccessToken, http.StatusUnauthorized, introspectionResponse{}},
+		{"public client", public.ClientID, "", tokens.AccessToken, http.StatusUnauthorized, introspectionResponse{}},
+		{"wrong secret", gateway.ClientID, "wrong", tokens.AccessToken, http.StatusUnauthorized, introspectionResponse{}},
+		{"no token", gateway.ClientID, gateway.ClientSecret, "", http.StatusBadRequest, introspectionResponse{}},
+		{"garbage", gateway.ClientID, gateway.ClientSecret, "not-a-token", http.StatusOK, introspectionResponse{Active: false}},
+		{"expired", gateway.ClientID, gateway.ClientSecret, expiredToken, http.StatusOK, introspectionResponse{Active: false}},
+		{"access token", gateway.ClientID, gateway.ClientSecret, tokens.AccessToken, http.StatusOK,
+			introspectionResponse{Active: true, TokenType: "Bearer", Sub: "1", Roles: []string{"admin"}}},
+		{"refresh token", gateway.ClientID, gateway.ClientSecret, tokens.RefreshToken, http.StatusOK,
+			introspectionResponse{Active: true, TokenType: "refresh_token", Sub: "1"}},
+		{"machine token", gateway.ClientID, gateway.ClientSecret, machineToken, http.StatusOK,
+			introspectionResponse{Active: true, TokenType: "Bearer", Sub: service.ClientID, ClientID: service.ClientID, Scope: "users:read"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := oauthClientRequest("/oauth/introspect", test.clientID, test.secret, url.Values{"token": {test.token}})
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var got introspectionResponse
+			_ = json.NewDecoder(resp.Body).Decode(&got)
+
+			if got.Active != test.expected.Active || got.TokenType != test.expected.TokenType || got.Sub != test.expected.Sub ||
+				got.ClientID != test.expected.ClientID || got.Scope != test.expected.Scope ||
+				strings.Join(got.Roles, ",") != strings.Join(test.expected.Roles, ",") {
+				t.Errorf("%s expected %+v, got %+v", test.name, test.expected, got)
+			}
+
+			if got.Active && got.Exp == 0 {
+				t.Errorf("%s expected exp to be set", test.name)
+			}
+		})
+	}
+}
+
+func Test_app_revokeToken(t *testing.T) {
+	var gateway registeredClient
+	_ = json.Unmarshal(registerTestClientResponse(t, `{"name":"Gateway","confidential":true}`), &gateway)
+
+	var service registeredClient
+	_ = json.Unmarshal(registerTestClientResponse(t, `{"name":"Reporting","scopes":["users:read"],"confidential":true}`), &service)
+
+	public := registerTestClient(t, `{"name":"SPA","redirect_uris":["https://app.example.com/callback"]}`)
+
+	serviceClient, _ := app.DB.GetOAuthClient(service.ClientID)
+	machineToken, _ := app.issueClientToken(serviceClient, "users:read")
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	firstParty, _ := app.generateTokenPair(&testUser)
+	accessOnly, _ := app.issueTokenPair(&testUser, "revoke-access-only", public.ClientID, "openid")
+	family, _ := app.issueTokenPair(&testUser, "revoke-family", public.ClientID, "openid")
+
+	active := func(token string) bool {
+		var got introspectionResponse
+
+		resp := oauthClientRequest("/oauth/introspect", gateway.ClientID, gateway.ClientSecret, url.Values{"token": {token}})
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+
+		return got.Active
+	}
+
+	var tests = []struct {
+		name               string
+		clientID           string
+		secret             string
+		token              string
+		expectedStatusCode int
+		revoked            []string
+		stillActive        []string
+	}{
+		{"no client", "", "", accessOnly.AccessToken, http.StatusUnauthorized, nil, []string{accessOnly.AccessToken}},
+		{"no token", public.ClientID, "", "", http.StatusBadRequest, nil, nil},
+		{"unknown token", public.ClientID, "", "not-a-token", http.StatusOK, nil, nil},
+		{"first party access token", public.ClientID, "", firstParty.AccessToken, http.StatusOK, nil, []string{firstParty.AccessToken}},
+		{"first party refresh token", public.ClientID, "", firstParty.RefreshToken, http.StatusOK,
+			nil, []string{firstParty.RefreshToken, firstParty.AccessToken}},
+		{"another client's access token", gateway.ClientID, gateway.ClientSecret, accessOnly.AccessToken, http.StatusOK,
+			nil, []string{accessOnly.AccessToken}},
+		{"another client's refresh token", gateway.ClientID, gateway.ClientSecret, family.RefreshToken, http.StatusOK,
+			nil, []string{family.RefreshToken, family.AccessToken}},
+		{"another client's machine token", gateway.ClientID, gateway.ClientSecret, machineToken, http.StatusOK,
+			nil, []string{machineToken}},
+		{"own access token", public.ClientID, "", accessOnly.AccessToken, http.StatusOK,
+			[]string{accessOnly.AccessToken}, []string{accessOnly.RefreshToken}},
+		{"own refresh token", public.ClientID, "", family.RefreshToken, http.StatusOK,
+			[]string{family.RefreshToken, family.AccessToken}, nil},
+		{"own machine token", service.ClientID, service.ClientSecret, machineToken, http.StatusOK, []string{machineToken}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := oauthClientRequest("/oauth/revoke", test.clientID, test.secret, url.Values{"token": {test.token}})
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			for _, token := range test.revoked {
+				if active(token) {
+					t.Errorf("%s expected token to be revoked", test.name)
+				}
+			}
+
+			for _, token := range test.stillActive {
+				if !active(token) {
+					t.Errorf("%s expected token to still be active", test.name)
+				}
+			}
+		})
+	}
+}
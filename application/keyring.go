@@ -0,0 +1,153 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Keyring holds the key new tokens are signed with, plus older keys which are still accepted when
+// verifying tokens. Keys are looked up by the kid header of the token being verified.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeyring returns a keyring which signs with active and also verifies tokens signed by others
+func NewKeyring(active *SigningKey, others ...*SigningKey) *Keyring {
+	k := &Keyring{}
+	k.set(active, others)
+
+	return k
+}
+
+// LoadKeyring builds a keyring from a directory of key files. Files ending in .pem hold an RSA or
+// Ed25519 private key, and files ending in .secret hold an HMAC secret. Every key is accepted for
+// verification; the file that sorts last by name signs new tokens, so naming files by date, e.g.
+// 2024-10-01.pem, makes the newest key the active one.
+func LoadKeyring(dir string) (*Keyring, error) {
+	k := &Keyring{}
+
+	err := k.Reload(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload replaces the keys in the keyring with the ones currently in dir. Adding a file with a later
+// name rotates to a new signing key; deleting a file retires that key. If dir can't be read, the
+// keyring is left as it was.
+func (k *Keyring) Reload(dir string) error {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	var keys []*SigningKey
+
+	// os.ReadDir returns entries sorted by file name
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		switch filepath.Ext(path) {
+		case ".pem":
+			key, err := LoadSigningKey(path)
+
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, key)
+		case ".secret":
+			secret, err := os.ReadFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, NewHMACKey(strings.TrimSpace(string(secret))))
+		}
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no .pem or .secret key files found in %s", dir)
+	}
+
+	k.set(keys[len(keys)-1], keys[:len(keys)-1])
+
+	return nil
+}
+
+func (k *Keyring) set(active *SigningKey, others []*SigningKey) {
+	keys := map[string]*SigningKey{active.ID: active}
+
+	for _, key := range others {
+		keys[key.ID] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active = active
+	k.keys = keys
+}
+
+// Active returns the key new tokens are signed with
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// Key returns the key with the given ID, if it is still in the keyring
+func (k *Keyring) Key(id string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+
+	return key, ok
+}
+
+// Keys returns every key in the keyring, sorted by ID
+func (k *Keyring) Keys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(k.keys))
+
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
+
+// Algorithms returns the signing algorithms of the keys in the keyring
+func (k *Keyring) Algorithms() []string {
+	var algs []string
+
+	for _, key := range k.Keys() {
+		if alg := key.Method.Alg(); !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+
+	return algs
+}
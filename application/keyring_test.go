@@ -0,0 +1,127 @@
+package application
+
+import (
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Keyring_rotateAndRetire(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "2024-01-01.secret"), []byte("old-secret"), 0600)
+
+	keys, err := LoadKeyring(dir)
+
+	if err != nil {
+		t.Fatalf("error loading keyring: %s", err)
+	}
+
+	keyringApp := app
+	keyringApp.Keys = keys
+
+	oldTokens, _ := keyringApp.generateTokenPair(&testUser)
+
+	// rotate by adding a newer key file
+	_ = os.WriteFile(filepath.Join(dir, "2024-02-01.secret"), []byte("new-secret"), 0600)
+
+	if err := keys.Reload(dir); err != nil {
+		t.Fatalf("error reloading keyring: %s", err)
+	}
+
+	newTokens, _ := keyringApp.generateTokenPair(&testUser)
+
+	verify := func(token string) error {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+		_, _, err := keyringApp.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+		return err
+	}
+
+	if err := verify(newTokens.AccessToken); err != nil {
+		t.Errorf("token signed with the active key did not verify: %s", err)
+	}
+
+	if err := verify(oldTokens.AccessToken); err != nil {
+		t.Errorf("token signed with a verification-only key did not verify: %s", err)
+	}
+
+	// retire the old key by removing its file
+	_ = os.Remove(filepath.Join(dir, "2024-01-01.secret"))
+
+	if err := keys.Reload(dir); err != nil {
+		t.Fatalf("error reloading keyring: %s", err)
+	}
+
+	if err := verify(oldTokens.AccessToken); err == nil {
+		t.Errorf("token signed with a retired key should not verify")
+	}
+
+	if err := verify(newTokens.AccessToken); err != nil {
+		t.Errorf("token signed with the active key did not verify after retiring the old key: %s", err)
+	}
+}
+
+func Test_LoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := LoadKeyring(dir)
+
+	if err == nil {
+		t.Errorf("expected error loading an empty directory")
+	}
+
+	pemKey, _ := os.ReadFile(writeKeyFile(t, "ed25519"))
+
+	_ = os.WriteFile(filepath.Join(dir, "2024-01-01.secret"), []byte("first-secret\n"), 0600)
+	_ = os.WriteFile(filepath.Join(dir, "2024-02-01.pem"), pemKey, 0600)
+	_ = os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0600)
+
+	keys, err := LoadKeyring(dir)
+
+	if err != nil {
+		t.Fatalf("error loading keyring: %s", err)
+	}
+
+	if keys.Active().Method.Alg() != "EdDSA" {
+		t.Errorf("expected the last file by name to sign, got %s key", keys.Active().Method.Alg())
+	}
+
+	if _, ok := keys.Key(NewHMACKey("first-secret").ID); !ok {
+		t.Errorf("expected the older secret to stay in the keyring for verification")
+	}
+
+	// rotate by adding a newer file, and retire by removing the oldest
+	_ = os.Remove(filepath.Join(dir, "2024-01-01.secret"))
+	_ = os.WriteFile(filepath.Join(dir, "2024-03-01.secret"), []byte("third-secret"), 0600)
+
+	err = keys.Reload(dir)
+
+	if err != nil {
+		t.Fatalf("error reloading keyring: %s", err)
+	}
+
+	if keys.Active().ID != NewHMACKey("third-secret").ID {
+		t.Errorf("expected the newest secret to sign after reload")
+	}
+
+	if _, ok := keys.Key(NewHMACKey("first-secret").ID); ok {
+		t.Errorf("expected the removed secret to be retired")
+	}
+
+	if len(keys.Keys()) != 2 {
+		t.Errorf("expected 2 keys after reload, got %d", len(keys.Keys()))
+	}
+}
@@ -0,0 +1,199 @@
+package application
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"os"
+)
+
+// SigningKey is a key we sign tokens with. For HMAC keys Sign and Verify are the same shared
+// secret; for RSA and Ed25519 keys Sign is the private key and Verify is the public key.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Sign   any
+	Verify any
+}
+
+// JWK is the JSON Web Key (RFC 7517) representation of a public key.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// NewHMACKey returns an HS256 key for a shared secret. The key ID is derived from the secret,
+// so every instance configured with the same secret agrees on it.
+func NewHMACKey(secret string) *SigningKey {
+	sum := sha256.Sum256([]byte(secret))
+
+	return &SigningKey{
+		ID:     hex.EncodeToString(sum[:8]),
+		Method: jwt.SigningMethodHS256,
+		Sign:   []byte(secret),
+		Verify: []byte(secret),
+	}
+}
+
+// LoadSigningKey reads an RSA or Ed25519 private key from a PEM file. RSA keys sign with RS256 and
+// Ed25519 keys with EdDSA; the key ID is the key's JWK thumbprint (RFC 7638).
+func LoadSigningKey(path string) (*SigningKey, error) {
+	contents, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded key", path)
+	}
+
+	var privateKey any
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block type %q", path, block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newAsymmetricKey(privateKey)
+}
+
+func newAsymmetricKey(privateKey any) (*SigningKey, error) {
+	key := &SigningKey{Sign: privateKey}
+
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.Verify = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Verify = k.Public()
+	default:
+		return nil, errors.New("unsupported private key type; use RSA or Ed25519")
+	}
+
+	jwk, _ := key.JWK()
+	key.ID = jwk.thumbprint()
+
+	return key, nil
+}
+
+// JWK returns the public half of the key as a JWK. HMAC keys have no public half, so ok is false.
+func (k *SigningKey) JWK() (jwk JWK, ok bool) {
+	jwk = JWK{
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: k.Method.Alg(),
+	}
+
+	switch pub := k.Verify.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// thumbprint computes the RFC 7638 thumbprint: a hash of the required members, in lexical order
+func (jwk JWK) thumbprint() string {
+	var members []byte
+
+	if jwk.KeyType == "RSA" {
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N})
+	} else {
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X})
+	}
+
+	sum := sha256.Sum256(members)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// signToken signs claims with the active signing key, naming the key in the kid header
+func (app *Application) signToken(claims jwt.MapClaims) (string, error) {
+	key := app.Keys.Active()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Sign)
+}
+
+// keyFunc finds the key to verify a token with, using the kid header. Tokens issued before we
+// added the kid header are checked against the active key.
+func (app *Application) keyFunc(token *jwt.Token) (any, error) {
+	keys := app.Keys
+	key := keys.Active()
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = keys.Key(kid)
+
+		if !ok {
+			return nil, fmt.Errorf("Unknown signing key: %s", kid)
+		}
+	}
+
+	// validate the signing method
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Verify, nil
+}
+
+// jwks publishes our public keys so that other services can verify our tokens, including tokens
+// signed by keys we have rotated away from but not yet retired
+func (app *Application) jwks(resp http.ResponseWriter, req *http.Request) {
+	keys := []JWK{}
+
+	for _, key := range app.Keys.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	resp.Header().Set("Cache-Control", "public, max-age=300")
+	_ = app.writeJSON(resp, http.StatusOK, keys, "keys")
+}
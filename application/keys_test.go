@@ -0,0 +1,172 @@
+package application
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKeyFile generates a key of the given type and writes it to a PEM file in a temp directory
+func writeKeyFile(t *testing.T, keyType string) string {
+	var block *pem.Block
+
+	switch keyType {
+	case "rsa":
+		key, _ := rsa.GenerateKey(rand.Reader, 2048)
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case "ed25519":
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		block = &pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a key")}
+	}
+
+	path := filepath.Join(t.TempDir(), keyType+".pem")
+	_ = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+
+	return path
+}
+
+func Test_LoadSigningKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyType       string
+		expectedAlg   string
+		errorExpected bool
+	}{
+		{"rsa", "rsa", "RS256", false},
+		{"ed25519", "ed25519", "EdDSA", false},
+		{"not a key", "certificate", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := LoadSigningKey(writeKeyFile(t, test.keyType))
+
+			if err != nil && !test.errorExpected {
+				t.Fatalf("%s did not expect error, but got one: %s", test.name, err)
+			}
+
+			if err == nil && test.errorExpected {
+				t.Fatalf("%s expected error, but got none", test.name)
+			}
+
+			if err == nil && key.Method.Alg() != test.expectedAlg {
+				t.Errorf("%s expected algorithm %s, got %s", test.name, test.expectedAlg, key.Method.Alg())
+			}
+		})
+	}
+
+	_, err := LoadSigningKey(filepath.Join(t.TempDir(), "missing.pem"))
+
+	if err == nil {
+		t.Errorf("expected error loading a missing file")
+	}
+}
+
+func Test_app_asymmetricTokens(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	for _, keyType := range []string{"rsa", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			key, _ := LoadSigningKey(writeKeyFile(t, keyType))
+			otherKey, _ := LoadSigningKey(writeKeyFile(t, keyType))
+
+			signingApp := app
+			signingApp.Keys = NewKeyring(key)
+
+			tokens, err := signingApp.generateTokenPair(&testUser)
+
+			if err != nil {
+				t.Fatalf("error generating tokens: %s", err)
+			}
+
+			parsed, _, _ := jwt.NewParser().ParseUnverified(tokens.AccessToken, jwt.MapClaims{})
+
+			if parsed.Header["kid"] != key.ID {
+				t.Errorf("expected kid %s, got %v", key.ID, parsed.Header["kid"])
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tokens.AccessToken))
+
+			_, _, err = signingApp.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+			if err != nil {
+				t.Errorf("token signed with %s key did not verify: %s", keyType, err)
+			}
+
+			// a different key pair, or the shared secret, must not verify the token
+			otherApp := app
+			otherApp.Keys = NewKeyring(otherKey)
+
+			_, _, err = otherApp.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+			if err == nil {
+				t.Errorf("token verified with the wrong key pair")
+			}
+
+			_, _, err = app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+			if err == nil {
+				t.Errorf("token verified with the shared secret")
+			}
+		})
+	}
+}
+
+func Test_app_jwks(t *testing.T) {
+	key, _ := LoadSigningKey(writeKeyFile(t, "ed25519"))
+
+	tests := []struct {
+		name         string
+		keys         *Keyring
+		expectedKeys int
+	}{
+		{"shared secret", NewKeyring(NewHMACKey("super-secret")), 0},
+		{"key pair", NewKeyring(key), 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jwksApp := app
+			jwksApp.Keys = test.keys
+
+			req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(jwksApp.jwks).ServeHTTP(resp, req)
+
+			var body struct {
+				Keys []JWK `json:"keys"`
+			}
+
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+
+			if len(body.Keys) != test.expectedKeys {
+				t.Fatalf("%s expected %d keys, got %d", test.name, test.expectedKeys, len(body.Keys))
+			}
+
+			if test.expectedKeys > 0 && (body.Keys[0].KeyID != key.ID || body.Keys[0].X == "") {
+				t.Errorf("%s published the wrong key: %+v", test.name, body.Keys[0])
+			}
+		})
+	}
+}
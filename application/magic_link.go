@@ -0,0 +1,232 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const tokenTypeMagicLink = "magic-link"
+
+// purposeMagicLink is the user token purpose recording which magic links have been used
+const purposeMagicLink = "magic-link"
+
+var magicLinkExpiry = time.Minute * 15
+
+var errInvalidMagicLink = errors.New("Invalid or expired link")
+
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type magicLinkLogin struct {
+	Token string `json:"token"`
+}
+
+// magicLinkPage asks the user to confirm they want to log in, then posts the link's token back.
+// Mail scanners and link previews open links in emails, so opening the link can't be what logs in.
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Log In</title>
+    <link rel="icon" href="data:;base64,iVBORw0KGgo=">
+    <link href="//cdn.jsdelivr.net/npm/bootstrap@5.2.1/dist/css/bootstrap.min.css" rel="stylesheet"
+          integrity="sha384-iYQeCzEYFbKjA/T2uDLTpkwGzCiq6soy8tYaI1GyVh/UjpbCx/TYkiZhlZB6+fzT" crossorigin="anonymous">
+</head>
+<body>
+<div class="container">
+    <h1 class="mt-3">Log In</h1>
+    <hr>
+    <input type="hidden" id="token" value="{{.}}">
+    <a class="btn btn-primary" id="login">Log me in</a>
+    <hr>
+    <div id="result"></div>
+</div>
+<script>
+    document.getElementById("login").addEventListener("click", function () {
+        const post = (url, payload) => fetch(url, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify(payload)
+        }).then(response => response.json());
+
+        post("/auth/magic-link/verify", {token: document.getElementById("token").value})
+            .then(data => {
+                if (!data.mfa_required) {
+                    return data;
+                }
+
+                const code = prompt("Enter the code from your authenticator app, or a recovery code");
+
+                return post("/auth/mfa", {mfa_token: data.mfa_token, code: code});
+            })
+            .then(data => {
+                if (data.access_token) {
+                    window.location = "/";
+                } else {
+                    document.getElementById("result").innerText = "That link is invalid or has expired.";
+                }
+            })
+            .catch(error => {
+                document.getElementById("result").innerText = error;
+            });
+    });
+</script>
+</body>
+</html>
+`))
+
+// requestMagicLink emails a single-use login link. Like forgotPassword, it responds the same way
+// whether or not the email address belongs to a user.
+func (app *Application) requestMagicLink(resp http.ResponseWriter, req *http.Request) {
+	var payload magicLinkRequest
+
+	err := app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByEmail(payload.Email)
+
+	if err == nil {
+		err = app.sendMagicLink(user)
+
+		if err != nil {
+			log.Println("Error sending magic link:", err)
+		}
+	}
+
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+// sendMagicLink emails a signed login link. The link's jti is also stored, hashed, as a user
+// token, so the link can only be used once. The link names the address it was sent to, since
+// following it verifies that address.
+func (app *Application) sendMagicLink(user *data.User) error {
+	jti, err := randomToken(16)
+
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(magicLinkExpiry)
+
+	_, err = app.DB.InsertUserToken(data.UserToken{
+		UserID:    user.ID,
+		Purpose:   purposeMagicLink,
+		TokenHash: hashToken(jti),
+		ExpiresAt: expiresAt,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeMagicLink
+	claims["jti"] = jti
+	claims["sub"] = fmt.Sprint(user.ID)
+	claims["email"] = user.Email
+	claims["aud"] = app.Domain
+	claims["iss"] = app.Domain
+	claims["exp"] = expiresAt.Unix()
+
+	token, err := app.signToken(claims)
+
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/auth/magic-link/verify?token=%s", app.BaseURL, url.QueryEscape(token))
+
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link within %s to log in:\n\n%s\n\n"+
+			"If you didn't ask to log in, you can ignore this email.\n", user.FirstName, magicLinkExpiry, link),
+	})
+}
+
+// confirmMagicLink is where a magic link leads. It only shows magicLinkPage; the link is used up by
+// verifyMagicLink, when the user confirms.
+func (app *Application) confirmMagicLink(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Referrer-Policy", "no-referrer")
+
+	err := magicLinkPage.Execute(resp, req.URL.Query().Get("token"))
+
+	if err != nil {
+		log.Println("Error rendering magic link page:", err)
+	}
+}
+
+// verifyMagicLink logs in the user a magic link was sent to. Following the link proves they own
+// the email address, so it is marked as verified too.
+func (app *Application) verifyMagicLink(resp http.ResponseWriter, req *http.Request) {
+	var payload magicLinkLogin
+
+	err := app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.validateToken(payload.Token, tokenTypeMagicLink)
+
+	if err != nil {
+		app.errorJSON(resp, errInvalidMagicLink, http.StatusBadRequest)
+		return
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil {
+		app.errorJSON(resp, errInvalidMagicLink, http.StatusBadRequest)
+		return
+	}
+
+	// refuse links which have been used before
+	token, err := app.DB.ConsumeUserToken(hashToken(claims.ID), purposeMagicLink)
+
+	if err != nil || token.UserID != userId {
+		app.errorJSON(resp, errInvalidMagicLink, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, errInvalidMagicLink, http.StatusBadRequest)
+		return
+	}
+
+	// the link was sent to an address which is no longer on the account
+	if user.Email != claims.Email {
+		app.errorJSON(resp, errInvalidMagicLink, http.StatusBadRequest)
+		return
+	}
+
+	if !user.EmailVerified {
+		err = app.DB.MarkEmailVerified(userId, claims.Email)
+
+		if err == nil {
+			user.EmailVerified = true
+		}
+	}
+
+	app.continueLogin(resp, req, user)
+}
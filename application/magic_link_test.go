@@ -0,0 +1,151 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_requestMagicLink(t *testing.T) {
+	var tests = []struct {
+		name               string
+		requestBody        string
+		expectedStatusCode int
+		expectEmail        bool
+	}{
+		{"known user", `{"email":"admin@example.com"}`, http.StatusAccepted, true},
+		{"unknown user", `{"email":"nobody@example.com"}`, http.StatusAccepted, false},
+		{"not JSON", `I'm not JSON`, http.StatusBadRequest, false},
+	}
+
+	sentMail := app.Mailer.(*mailer.MemoryMailer)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sentBefore := len(sentMail.Messages())
+
+			req, _ := http.NewRequest("POST", "/auth/magic-link", strings.NewReader(test.requestBody))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.requestMagicLink).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			sent := len(sentMail.Messages()) > sentBefore
+
+			if test.expectEmail != sent {
+				t.Errorf("%s expected an email to be sent: %t, but sent: %t", test.name, test.expectEmail, sent)
+			}
+		})
+	}
+}
+
+func Test_app_verifyMagicLink(t *testing.T) {
+	// following a link verifies the email address, so use a separate repo to keep the admin user
+	// unverified for the other tests
+	linkApp := app
+	linkApp.DB = &dbrepo.TestDBRepo{}
+
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	_ = linkApp.sendVerificationEmail(&testUser)
+	verificationToken := linkToken(t, "admin@example.com")
+
+	_ = linkApp.sendMagicLink(&testUser)
+	token := linkToken(t, "admin@example.com")
+
+	// a link sent before the user changed their email address
+	previousAddress := testUser
+	previousAddress.Email = "old@example.com"
+	_ = linkApp.sendMagicLink(&previousAddress)
+	oldAddressToken := linkToken(t, "old@example.com")
+
+	// opening the link only shows a page asking to confirm, and leaves the link usable
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/auth/magic-link/verify?token="+url.QueryEscape(token), nil)
+		resp := httptest.NewRecorder()
+
+		http.HandlerFunc(linkApp.confirmMagicLink).ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK || !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("expected the confirmation page, got status code %d", resp.Code)
+		}
+
+		if !strings.Contains(resp.Body.String(), token) || strings.Contains(resp.Header().Get("Set-Cookie"), refreshCookieName) {
+			t.Errorf("expected the page to carry the token without logging in")
+		}
+	}
+
+	body, _ := json.Marshal(magicLinkLogin{Token: oldAddressToken})
+	req, _ := http.NewRequest("POST", "/auth/magic-link/verify", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+
+	http.HandlerFunc(linkApp.verifyMagicLink).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected a link for a previous email address to be refused, got status code %d", resp.Code)
+	}
+
+	if user, _ := linkApp.DB.GetUser(1); user.EmailVerified {
+		t.Errorf("expected a link for a previous email address not to verify the current one")
+	}
+
+	var tests = []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+	}{
+		{"no token", "", http.StatusBadRequest},
+		{"garbage token", "not-a-token", http.StatusBadRequest},
+		{"email verification token", verificationToken, http.StatusBadRequest},
+		{"valid link", token, http.StatusOK},
+		{"replayed link", token, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, _ := json.Marshal(magicLinkLogin{Token: test.token})
+			req, _ := http.NewRequest("POST", "/auth/magic-link/verify", bytes.NewReader(body))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(linkApp.verifyMagicLink).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var tokenPair TokenPairs
+			_ = json.NewDecoder(resp.Body).Decode(&tokenPair)
+
+			if tokenPair.AccessToken == "" || tokenPair.RefreshToken == "" {
+				t.Errorf("%s expected a token pair", test.name)
+			}
+
+			if !strings.Contains(resp.Header().Get("Set-Cookie"), refreshCookieName) {
+				t.Errorf("%s expected the refresh cookie to be set", test.name)
+			}
+
+			if user, _ := linkApp.DB.GetUser(1); !user.EmailVerified {
+				t.Errorf("%s expected the email address to be verified", test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package application
+
+import (
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"strconv"
+)
+
+// profileUpdate is the payload for PATCH /me. Only the name and email can be changed; the
+// privileged fields are listed so we can refuse them rather than silently ignoring them.
+type profileUpdate struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+	ID        *int    `json:"id"`
+	IsAdmin   *int    `json:"is_admin"`
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// currentUser looks up the user named by the sub claim of the caller's token
+func (app *Application) currentUser(req *http.Request) (*data.User, error) {
+	claims, ok := claimsFromContext(req.Context())
+
+	if !ok {
+		return nil, errors.New("Unauthorized")
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil {
+		return nil, errors.New("Token is not for a user")
+	}
+
+	return app.DB.GetUser(userId)
+}
+
+func (app *Application) getMe(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, user)
+}
+
+func (app *Application) updateMe(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	var update profileUpdate
+
+	err = app.readJSON(resp, req, &update)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	if update.ID != nil || update.IsAdmin != nil {
+		app.errorJSON(resp, errors.New("id and is_admin cannot be changed through /me"), http.StatusForbidden)
+		return
+	}
+
+	previous := *user
+
+	if update.FirstName != nil {
+		user.FirstName = *update.FirstName
+	}
+
+	if update.LastName != nil {
+		user.LastName = *update.LastName
+	}
+
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+
+	var changed []string
+
+	if update.FirstName != nil {
+		changed = append(changed, "first_name")
+	}
+
+	if update.LastName != nil {
+		changed = append(changed, "last_name")
+	}
+
+	if update.Email != nil {
+		changed = append(changed, "email")
+	}
+
+	if errs := validateUser(user).only(changed...); len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.DB.UpdateUser(*user)
+
+	if isVersionConflict(err) {
+		app.writeVersionConflict(resp, req)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if user.Email != previous.Email {
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+
+	app.sendVerificationEmailIfChanged(&previous, user)
+
+	_ = app.writeJSON(resp, http.StatusOK, user)
+}
+
+func (app *Application) changeMyPassword(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	var change passwordChange
+
+	err = app.readJSON(resp, req, &change)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	var errs validationErrors
+	validatePassword(&errs, "new_password", change.NewPassword)
+
+	if len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	matches, err := user.PasswordMatches(change.CurrentPassword)
+
+	if err != nil || !matches {
+		app.errorJSON(resp, errors.New("Current password is incorrect"), http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.ResetPassword(user.ID, change.NewPassword)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
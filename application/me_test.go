@@ -0,0 +1,84 @@
+package application
+
+import (
+	"encoding/json"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_app_me(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	var tests = []struct {
+		name               string
+		method             string
+		route              string
+		json               string
+		setHeader          bool
+		expectedStatusCode int
+		expectedFirstName  string
+	}{
+		{"get me", "GET", "/me", "", true, http.StatusOK, "Admin"},
+		{"get me without token", "GET", "/me", "", false, http.StatusUnauthorized, ""},
+		{"update name", "PATCH", "/me", `{"first_name":"Administrator"}`, true, http.StatusOK, "Administrator"},
+		{"update is_admin", "PATCH", "/me", `{"is_admin":1}`, true, http.StatusForbidden, ""},
+		{"update id", "PATCH", "/me", `{"id":2,"first_name":"Jack"}`, true, http.StatusForbidden, ""},
+		{"update invalid json", "PATCH", "/me", `{first_name:"Administrator"}`, true, http.StatusBadRequest, ""},
+		{"update blank name", "PATCH", "/me", `{"last_name":""}`, true, http.StatusUnprocessableEntity, ""},
+		{"update invalid email", "PATCH", "/me", `{"email":"admin"}`, true, http.StatusUnprocessableEntity, ""},
+		{"change password wrong current", "PUT", "/me/password", `{"current_password":"wrong","new_password":"new-secret"}`, true, http.StatusForbidden, ""},
+		{"change password missing new", "PUT", "/me/password", `{"current_password":"secret"}`, true, http.StatusUnprocessableEntity, ""},
+		{"change password too short", "PUT", "/me/password", `{"current_password":"secret","new_password":"short"}`, true, http.StatusUnprocessableEntity, ""},
+		{"change password", "PUT", "/me/password", `{"current_password":"secret","new_password":"new-secret"}`, true, http.StatusNoContent, ""},
+	}
+
+	mux := app.Routes()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body io.Reader
+
+			if test.json != "" {
+				body = strings.NewReader(test.json)
+			}
+
+			req, _ := http.NewRequest(test.method, test.route, body)
+
+			if test.setHeader {
+				req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			}
+
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if test.expectedFirstName != "" {
+				var user data.User
+				_ = json.NewDecoder(resp.Body).Decode(&user)
+
+				if user.FirstName != test.expectedFirstName {
+					t.Errorf("%s expected first name %s, got %s", test.name, test.expectedFirstName, user.FirstName)
+				}
+
+				if user.Email != "admin@example.com" {
+					t.Errorf("%s should not have changed the email, got %s", test.name, user.Email)
+				}
+			}
+		})
+	}
+}
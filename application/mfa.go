@@ -0,0 +1,398 @@
+package application
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp/totp"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tokenTypeMFAChallenge = "mfa-challenge"
+
+// a challenge token lets the user finish logging in with a code for mfaChallengeExpiry after
+// giving the right password
+var mfaChallengeExpiry = time.Minute * 5
+
+// TOTP codes change every totpPeriod; we also accept the codes either side of the current one,
+// to allow for clock drift between the server and the user's phone
+const totpPeriod = 30
+
+const recoveryCodeCount = 10
+
+var errInvalidMFACode = errors.New("Invalid code")
+
+// mfaChallenge is what /auth returns instead of tokens when the user has a second factor. The
+// mfa_token is exchanged at /auth/mfa, along with a code, for the real tokens.
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type mfaLogin struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type mfaCode struct {
+	Code string `json:"code"`
+}
+
+type mfaEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// issueMFAChallenge signs a short-lived token saying the user has given the right password. It has
+// its own typ, so it can't be used as an access token, and a jti, so it can only be used to log in
+// once.
+func (app *Application) issueMFAChallenge(user *data.User) (string, error) {
+	jti, err := randomToken(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeMFAChallenge
+	claims["jti"] = jti
+	claims["sub"] = fmt.Sprint(user.ID)
+	claims["aud"] = app.Domain
+	claims["iss"] = app.Domain
+	claims["exp"] = time.Now().Add(mfaChallengeExpiry).Unix()
+
+	return app.signToken(claims)
+}
+
+// validateTOTP checks a code against the secret at the current time step and the steps either
+// side, returning the time step the code belongs to
+func validateTOTP(secret, code string) (int64, bool) {
+	now := time.Now()
+
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+
+		expected, err := totp.GenerateCode(secret, at)
+
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+
+	return 0, false
+}
+
+// checkMFACode accepts either a TOTP code which hasn't been used before or an unused recovery code
+func (app *Application) checkMFACode(mfa *data.MFA, code string) bool {
+	code = strings.TrimSpace(code)
+
+	if step, ok := validateTOTP(mfa.Secret, code); ok {
+		return app.DB.UseMFAStep(mfa.UserID, step) == nil
+	}
+
+	return app.DB.UseRecoveryCode(mfa.UserID, hashToken(normalizeRecoveryCode(code))) == nil
+}
+
+// newRecoveryCodes returns a set of recovery codes to show the user, and their hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	var codes, hashes []string
+
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes without the dash, or in capitals
+func normalizeRecoveryCode(code string) string {
+	return strings.ReplaceAll(strings.ToLower(code), "-", "")
+}
+
+// authenticateMFA is the second step of logging in for users with a second factor
+func (app *Application) authenticateMFA(resp http.ResponseWriter, req *http.Request) {
+	var payload mfaLogin
+
+	err := app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := app.validateToken(payload.MFAToken, tokenTypeMFAChallenge)
+
+	if err != nil || claims.ID == "" {
+		app.errorJSON(resp, errors.New("Invalid or expired MFA token"), http.StatusUnauthorized)
+		return
+	}
+
+	// challenges which have already been used to log in are on the same denylist as access tokens
+	if used, err := app.DB.IsAccessTokenRevoked(claims.ID, ""); err != nil || used {
+		app.errorJSON(resp, errors.New("Invalid or expired MFA token"), http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Invalid or expired MFA token"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	// guessing codes counts towards the same lockout as guessing passwords
+	if lockedUntil, locked := app.loginLockedUntil(user.Email, req); locked {
+		resp.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		app.errorJSON(resp, errLoginLocked, http.StatusTooManyRequests)
+		return
+	}
+
+	mfa, err := app.DB.GetMFA(user.ID)
+
+	if err != nil || mfa.ConfirmedAt == nil || !app.checkMFACode(mfa, payload.Code) {
+		app.recordLoginFailure(user.Email, req)
+		app.errorJSON(resp, errInvalidMFACode, http.StatusUnauthorized)
+		return
+	}
+
+	app.clearLoginFailures(user.Email, req)
+
+	err = app.DB.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	app.completeLogin(resp, req, user)
+}
+
+// enrollMFA starts setting up a second factor for the current user. It returns the secret both as
+// an otpauth:// URI and as a QR code of that URI, for the user to scan into their authenticator
+// app; the factor isn't turned on until they confirm it with a code.
+func (app *Application) enrollMFA(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	mfa, err := app.DB.GetMFA(user.ID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if mfa.ConfirmedAt != nil {
+		app.errorJSON(resp, errors.New("Two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      app.Domain,
+		AccountName: user.Email,
+	})
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	image, err := key.Image(256, 256)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	var qrCode bytes.Buffer
+
+	err = png.Encode(&qrCode, image)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.SetMFASecret(user.ID, key.Secret())
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, mfaEnrollment{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+	})
+}
+
+// confirmMFA turns on the second factor once the user shows a code from their authenticator app,
+// and returns their recovery codes. This is the only time the recovery codes are shown.
+func (app *Application) confirmMFA(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	var payload mfaCode
+
+	err = app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := app.DB.GetMFA(user.ID)
+
+	if err != nil || mfa.Secret == "" {
+		app.errorJSON(resp, errors.New("Two-factor authentication enrollment has not been started"), http.StatusBadRequest)
+		return
+	}
+
+	if mfa.ConfirmedAt != nil {
+		app.errorJSON(resp, errors.New("Two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	step, ok := validateTOTP(mfa.Secret, strings.TrimSpace(payload.Code))
+
+	if !ok {
+		app.errorJSON(resp, errInvalidMFACode, http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.ConfirmMFA(user.ID, step, hashes)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, recoveryCodes{RecoveryCodes: codes})
+}
+
+// regenerateRecoveryCodes replaces the current user's recovery codes, e.g. when they have used
+// most of them. It needs a current code, so a stolen access token alone can't do it.
+func (app *Application) regenerateRecoveryCodes(resp http.ResponseWriter, req *http.Request) {
+	user, ok := app.requireMFACode(resp, req)
+
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.ReplaceRecoveryCodes(user.ID, hashes)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, recoveryCodes{RecoveryCodes: codes})
+}
+
+// disableMFA turns off the current user's second factor. Like regenerating recovery codes, it
+// needs a current code.
+func (app *Application) disableMFA(resp http.ResponseWriter, req *http.Request) {
+	user, ok := app.requireMFACode(resp, req)
+
+	if !ok {
+		return
+	}
+
+	err := app.DB.DeleteMFA(user.ID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// requireMFACode reads a code from the request body and checks it against the current user's
+// second factor, writing an error response if it doesn't match
+func (app *Application) requireMFACode(resp http.ResponseWriter, req *http.Request) (*data.User, bool) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	var payload mfaCode
+
+	err = app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return nil, false
+	}
+
+	mfa, err := app.DB.GetMFA(user.ID)
+
+	if err != nil || mfa.ConfirmedAt == nil {
+		app.errorJSON(resp, errors.New("Two-factor authentication is not enabled"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !app.checkMFACode(mfa, payload.Code) {
+		app.errorJSON(resp, errInvalidMFACode, http.StatusForbidden)
+		return nil, false
+	}
+
+	return user, true
+}
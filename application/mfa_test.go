@@ -0,0 +1,172 @@
+package application
+
+import (
+	"encoding/json"
+	"github.com/pquerna/otp/totp"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_app_mfa(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	mux := app.Routes()
+
+	send := func(method, route, body, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	login := func() mfaChallenge {
+		var challenge mfaChallenge
+
+		resp := send("POST", "/auth", `{"email":"admin@example.com","password":"secret"}`, "")
+		_ = json.NewDecoder(resp.Body).Decode(&challenge)
+
+		return challenge
+	}
+
+	codeBody := func(code string) string {
+		return `{"code":"` + code + `"}`
+	}
+
+	if resp := send("POST", "/me/mfa/confirm", codeBody("123456"), tokens.AccessToken); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected status code 400 confirming before enrolling, got %d", resp.Code)
+	}
+
+	// enroll
+	resp := send("POST", "/me/mfa", "", tokens.AccessToken)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code 200 enrolling, got %d", resp.Code)
+	}
+
+	var enrollment mfaEnrollment
+	_ = json.NewDecoder(resp.Body).Decode(&enrollment)
+
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") || !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Errorf("unexpected enrollment: %+v", enrollment)
+	}
+
+	// enrollment isn't finished, so logging in still returns tokens
+	if challenge := login(); challenge.MFARequired {
+		t.Errorf("expected no MFA challenge before enrollment is confirmed")
+	}
+
+	if resp := send("POST", "/me/mfa/confirm", codeBody("not-a-code"), tokens.AccessToken); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected status code 400 confirming with a wrong code, got %d", resp.Code)
+	}
+
+	confirmCode, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+
+	resp = send("POST", "/me/mfa/confirm", codeBody(confirmCode), tokens.AccessToken)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code 200 confirming, got %d", resp.Code)
+	}
+
+	var codes recoveryCodes
+	_ = json.NewDecoder(resp.Body).Decode(&codes)
+
+	if len(codes.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes.RecoveryCodes))
+	}
+
+	if resp := send("POST", "/me/mfa", "", tokens.AccessToken); resp.Code != http.StatusConflict {
+		t.Errorf("expected status code 409 enrolling twice, got %d", resp.Code)
+	}
+
+	// now logging in is two steps
+	challenge := login()
+
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("expected an MFA challenge, got %+v", challenge)
+	}
+
+	if resp := send("GET", "/me", "", challenge.MFAToken); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code 401 using the challenge as an access token, got %d", resp.Code)
+	}
+
+	nextCode, _ := totp.GenerateCode(enrollment.Secret, time.Now().Add(totpPeriod*time.Second))
+
+	// each challenge can only be used to log in once
+	secondChallenge := login()
+	thirdChallenge := login()
+
+	var tests = []struct {
+		name               string
+		mfaToken           string
+		code               string
+		expectedStatusCode int
+	}{
+		{"wrong code", challenge.MFAToken, "000000x", http.StatusUnauthorized},
+		{"replayed code", challenge.MFAToken, confirmCode, http.StatusUnauthorized},
+		{"bad challenge", tokens.AccessToken, nextCode, http.StatusUnauthorized},
+		{"valid code", challenge.MFAToken, nextCode, http.StatusOK},
+		{"valid code again", secondChallenge.MFAToken, nextCode, http.StatusUnauthorized},
+		{"used challenge", challenge.MFAToken, codes.RecoveryCodes[2], http.StatusUnauthorized},
+		{"recovery code", secondChallenge.MFAToken, strings.ToUpper(codes.RecoveryCodes[0]), http.StatusOK},
+		{"recovery code again", thirdChallenge.MFAToken, codes.RecoveryCodes[0], http.StatusUnauthorized},
+		{"unused recovery code with a used challenge", secondChallenge.MFAToken, codes.RecoveryCodes[2], http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := send("POST", "/auth/mfa", `{"mfa_token":"`+test.mfaToken+`","code":"`+test.code+`"}`, "")
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code == http.StatusOK {
+				var tokenPair TokenPairs
+				_ = json.NewDecoder(resp.Body).Decode(&tokenPair)
+
+				if tokenPair.AccessToken == "" {
+					t.Errorf("%s expected an access token", test.name)
+				}
+			}
+		})
+	}
+
+	// new recovery codes replace the old ones
+	resp = send("POST", "/me/mfa/recovery-codes", codeBody(codes.RecoveryCodes[1]), tokens.AccessToken)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code 200 regenerating recovery codes, got %d", resp.Code)
+	}
+
+	var newCodes recoveryCodes
+	_ = json.NewDecoder(resp.Body).Decode(&newCodes)
+
+	if resp := send("DELETE", "/me/mfa", codeBody(codes.RecoveryCodes[2]), tokens.AccessToken); resp.Code != http.StatusForbidden {
+		t.Errorf("expected status code 403 disabling with an old recovery code, got %d", resp.Code)
+	}
+
+	if resp := send("DELETE", "/me/mfa", codeBody(newCodes.RecoveryCodes[0]), tokens.AccessToken); resp.Code != http.StatusNoContent {
+		t.Errorf("expected status code 204 disabling, got %d", resp.Code)
+	}
+
+	if challenge := login(); challenge.MFARequired {
+		t.Errorf("expected no MFA challenge after disabling")
+	}
+}
@@ -0,0 +1,581 @@
+package application
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var authorizationCodeExpiry = time.Minute * 5
+
+var errOAuthClientNotAllowed = errors.New("Tokens issued to OAuth clients cannot be used to change your account")
+
+// oauthError is an error response in the shape RFC 6749 defines, either written as JSON or added
+// to the client's redirect URI
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Description
+}
+
+// authorizationRequest holds the parameters of an authorization code request. The browser brings
+// them to GET /oauth/authorize in the query string, and the login page posts them back as JSON
+// once the user has logged in, along with whether they approved the request.
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce,omitempty"`
+	Approve             *bool  `json:"approve,omitempty"`
+}
+
+// consentRequest tells the login page to ask the user whether the client may have these scopes
+type consentRequest struct {
+	ConsentRequired bool     `json:"consent_required"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+}
+
+// authorizationResponse tells the login page where to send the browser next
+type authorizationResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// oauthClientRegistration is the payload for registering a client. Confidential clients are given
+// a secret, which is only ever shown in the registration response.
+type oauthClientRegistration struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+type registeredClient struct {
+	data.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (app *Application) oauthErrorJSON(resp http.ResponseWriter, status int, code, description string) {
+	resp.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(resp, status, oauthError{Code: code, Description: description})
+}
+
+// validateAuthorizationRequest checks an authorization request, filling in the redirect URI and
+// scope if the client left them out. If the client or redirect URI can't be trusted the returned
+// client is nil, and the error must be shown to the user rather than sent to the redirect URI.
+func (app *Application) validateAuthorizationRequest(ar *authorizationRequest) (*data.OAuthClient, error) {
+	client, err := app.DB.GetOAuthClient(ar.ClientID)
+
+	if err != nil {
+		return nil, &oauthError{"invalid_request", "Unknown client"}
+	}
+
+	if ar.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		ar.RedirectURI = client.RedirectURIs[0]
+	}
+
+	// redirect URIs must match one that was registered exactly, or we would be handing codes to
+	// whoever asked for them
+	if !slices.Contains(client.RedirectURIs, ar.RedirectURI) {
+		return nil, &oauthError{"invalid_request", "Redirect URI is not registered for this client"}
+	}
+
+	if ar.ResponseType != "code" {
+		return client, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+
+	// public clients can't keep a secret, so PKCE is what stops an intercepted code being used
+	if ar.CodeChallengeMethod != "S256" || len(ar.CodeChallenge) < 43 || len(ar.CodeChallenge) > 128 {
+		return client, &oauthError{"invalid_request", "A code_challenge using the S256 method is required"}
+	}
+
+	scope, err := clientScope(client, ar.Scope)
+
+	if err != nil {
+		return client, err
+	}
+
+	ar.Scope = scope
+
+	return client, nil
+}
+
+// clientScope checks the scopes a client asked for are ones it was registered with, or are OpenID
+// Connect scopes, which any client may ask for. A client which doesn't ask for any scopes gets all
+// of the ones it was registered with.
+func clientScope(client *data.OAuthClient, requested string) (string, error) {
+	scopes := strings.Fields(requested)
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) && !slices.Contains(oidcScopes, scope) {
+			return "", &oauthError{"invalid_scope", "Scope " + scope + " is not allowed for this client"}
+		}
+	}
+
+	return strings.Join(scopes, " "), nil
+}
+
+// redirectWith adds parameters to a redirect URI, keeping any query it already has
+func redirectWith(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func errorRedirect(ar *authorizationRequest, err error) string {
+	params := url.Values{"state": {ar.State}}
+
+	var oauthErr *oauthError
+
+	if errors.As(err, &oauthErr) {
+		params.Set("error", oauthErr.Code)
+		params.Set("error_description", oauthErr.Description)
+	} else {
+		params.Set("error", "server_error")
+	}
+
+	return redirectWith(ar.RedirectURI, params)
+}
+
+// authorize is where clients send the browser to start the authorization code flow. Once the
+// request checks out, the browser is sent on to the login page, which logs the user in, asks for
+// their consent and posts the request back to approveAuthorization.
+func (app *Application) authorize(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	ar := authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Nonce:               query.Get("nonce"),
+	}
+
+	client, err := app.validateAuthorizationRequest(&ar)
+
+	if client == nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if err != nil {
+		http.Redirect(resp, req, errorRedirect(&ar, err), http.StatusFound)
+		return
+	}
+
+	http.Redirect(resp, req, app.BaseURL+"/authorize.html?"+req.URL.RawQuery, http.StatusFound)
+}
+
+// approveAuthorization issues an authorization code for the logged in user. If the user hasn't
+// already agreed to give the client the scopes it asked for, it asks the login page to get their
+// consent first.
+func (app *Application) approveAuthorization(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	var ar authorizationRequest
+
+	err = app.readJSON(resp, req, &ar)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, err := app.validateAuthorizationRequest(&ar)
+
+	if client == nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if err != nil {
+		_ = app.writeJSON(resp, http.StatusOK, authorizationResponse{RedirectTo: errorRedirect(&ar, err)})
+		return
+	}
+
+	if ar.Approve != nil && !*ar.Approve {
+		err = &oauthError{"access_denied", "The user denied the request"}
+		_ = app.writeJSON(resp, http.StatusOK, authorizationResponse{RedirectTo: errorRedirect(&ar, err)})
+		return
+	}
+
+	scopes := strings.Fields(ar.Scope)
+
+	var granted []string
+
+	consent, err := app.DB.GetOAuthConsent(user.ID, client.ClientID)
+	consented := err == nil
+
+	if consented {
+		granted = strings.Fields(consent.Scope)
+	}
+
+	missing := slices.DeleteFunc(slices.Clone(scopes), func(scope string) bool {
+		return slices.Contains(granted, scope)
+	})
+
+	if !consented || len(missing) > 0 {
+		if ar.Approve == nil {
+			_ = app.writeJSON(resp, http.StatusOK, consentRequest{
+				ConsentRequired: true,
+				ClientName:      client.Name,
+				Scopes:          scopes,
+			})
+			return
+		}
+
+		err = app.DB.SaveOAuthConsent(data.OAuthConsent{
+			UserID:   user.ID,
+			ClientID: client.ClientID,
+			Scope:    strings.Join(append(granted, missing...), " "),
+		})
+
+		if err != nil {
+			app.errorJSON(resp, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	code, err := randomToken(32)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = app.DB.InsertAuthorizationCode(data.AuthorizationCode{
+		CodeHash:            hashToken(code),
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         ar.RedirectURI,
+		Scope:               ar.Scope,
+		CodeChallenge:       ar.CodeChallenge,
+		CodeChallengeMethod: ar.CodeChallengeMethod,
+		Nonce:               ar.Nonce,
+		ExpiresAt:           time.Now().Add(authorizationCodeExpiry),
+	})
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, authorizationResponse{
+		RedirectTo: redirectWith(ar.RedirectURI, url.Values{"code": {code}, "state": {ar.State}}),
+	})
+}
+
+// oauthToken is the OAuth2 token endpoint. Parameters are form encoded, as RFC 6749 requires.
+func (app *Application) oauthToken(resp http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_request", "Could not parse form")
+		return
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		app.exchangeAuthorizationCode(resp, req)
+	case "refresh_token":
+		app.oauthRefresh(resp, req)
+	case "client_credentials":
+		app.clientCredentialsGrant(resp, req)
+	default:
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+// exchangeAuthorizationCode swaps an authorization code for tokens. The client has to send the
+// PKCE verifier whose hash it sent to the authorization endpoint, which proves it is the same
+// client that started the flow. Confidential clients must also authenticate with their secret.
+// If the client asked for the openid scope, it also gets an ID token. The tokens start a session,
+// so the user can see the client among their logins and end it.
+func (app *Application) exchangeAuthorizationCode(resp http.ResponseWriter, req *http.Request) {
+	client, err := app.authenticateClient(req)
+
+	if err != nil {
+		app.invalidClient(resp)
+		return
+	}
+
+	code, err := app.DB.ConsumeAuthorizationCode(hashToken(req.PostForm.Get("code")))
+
+	if err != nil || code.ClientID != client.ClientID || code.RedirectURI != req.PostForm.Get("redirect_uri") {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, req.PostForm.Get("code_verifier")) {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Code verifier does not match the code challenge")
+		return
+	}
+
+	user, err := app.DB.GetUser(code.UserID)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Unknown user")
+		return
+	}
+
+	tokenPair, err := app.startClientSession(req, user, client, code.Scope)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	var idToken string
+
+	if slices.Contains(strings.Fields(code.Scope), scopeOpenID) {
+		idToken, err = app.issueIDToken(user, client.ClientID, code.Nonce)
+
+		if err != nil {
+			app.oauthErrorJSON(resp, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+	}
+
+	app.writeOAuthTokens(resp, tokenPair, code.Scope, idToken)
+}
+
+// oauthRefresh rotates a refresh token, the same way as /refresh-token. The client has to
+// authenticate, and can only refresh tokens that were issued to it.
+func (app *Application) oauthRefresh(resp http.ResponseWriter, req *http.Request) {
+	client, err := app.authenticateClient(req)
+
+	if err != nil {
+		app.invalidClient(resp)
+		return
+	}
+
+	refreshToken := req.PostForm.Get("refresh_token")
+
+	claims, err := app.validateToken(refreshToken, tokenTypeRefresh)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", "Unknown user")
+		return
+	}
+
+	tokenPair, err := app.rotateRefreshToken(refreshToken, user, client.ClientID)
+
+	if err != nil {
+		app.oauthErrorJSON(resp, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	app.writeOAuthTokens(resp, tokenPair, "", "")
+}
+
+// denyOAuthClients blocks requests made with a token issued to an OAuth client. The user granted
+// the client a scope, but changing the account needs no permission, so a client could otherwise
+// change the email address and take the account over, or make an API key outside its scope. It
+// must run after authRequired.
+func (app *Application) denyOAuthClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		claims, ok := claimsFromContext(req.Context())
+
+		if !ok || claims.ClientID != "" {
+			app.errorJSON(resp, errOAuthClientNotAllowed, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+func (app *Application) writeOAuthTokens(resp http.ResponseWriter, tokenPair TokenPairs, scope, idToken string) {
+	resp.Header().Set("Cache-Control", "no-store")
+
+	_ = app.writeJSON(resp, http.StatusOK, oauthTokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwtTokenExpiry.Seconds()),
+		RefreshToken: tokenPair.RefreshToken,
+		Scope:        scope,
+		IDToken:      idToken,
+	})
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against the S256 challenge (RFC 7636)
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validRedirectURI accepts absolute URIs without a fragment. Plain http is only allowed for
+// loopback addresses, for native apps listening locally; other apps may use a custom scheme.
+func validRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.ContainsAny(redirectURI, " \t\n") {
+		return false
+	}
+
+	if u.Scheme == "http" {
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+
+	return u.Scheme != "javascript" && u.Scheme != "data"
+}
+
+func (app *Application) allOAuthClients(resp http.ResponseWriter, req *http.Request) {
+	clients, err := app.DB.AllOAuthClients()
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, clients)
+}
+
+// registerOAuthClient registers a new client and returns it, including its generated client ID
+func (app *Application) registerOAuthClient(resp http.ResponseWriter, req *http.Request) {
+	var registration oauthClientRegistration
+
+	err := app.readJSON(resp, req, &registration)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	// a client which only uses the client credentials grant never redirects anyone
+	if registration.Name == "" || len(registration.RedirectURIs) == 0 && !registration.Confidential {
+		app.errorJSON(resp, errors.New("name and at least one redirect URI are required"), http.StatusBadRequest)
+		return
+	}
+
+	for _, redirectURI := range registration.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			app.errorJSON(resp, errors.New("invalid redirect URI: "+redirectURI), http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, scope := range registration.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n") {
+			app.errorJSON(resp, errors.New("invalid scope: "+strconv.Quote(scope)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	clientID, err := randomToken(16)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	client := data.OAuthClient{
+		ClientID:     clientID,
+		Name:         registration.Name,
+		RedirectURIs: registration.RedirectURIs,
+		Scopes:       registration.Scopes,
+	}
+
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	var secret string
+
+	if registration.Confidential {
+		secret, err = randomToken(32)
+
+		if err != nil {
+			app.errorJSON(resp, err, http.StatusInternalServerError)
+			return
+		}
+
+		client.SecretHash = hashToken(secret)
+	}
+
+	client.ID, err = app.DB.InsertOAuthClient(client)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusCreated, registeredClient{OAuthClient: client, ClientSecret: secret})
+}
@@ -0,0 +1,309 @@
+package application
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// registerTestClient registers an OAuth client through the admin route and returns it
+func registerTestClient(t *testing.T, registration string) data.OAuthClient {
+	var client data.OAuthClient
+	_ = json.Unmarshal(registerTestClientResponse(t, registration), &client)
+
+	return client
+}
+
+// registerTestClientResponse registers an OAuth client and returns the raw registration response,
+// which includes the secret for confidential clients
+func registerTestClientResponse(t *testing.T, registration string) []byte {
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1}
+	adminTokens, _ := app.generateTokenPair(&adminUser)
+
+	req, _ := http.NewRequest("POST", "/admin/oauth/clients", strings.NewReader(registration))
+	req.Header.Set("Authorization", "Bearer "+adminTokens.AccessToken)
+	resp := httptest.NewRecorder()
+
+	app.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status code 201 registering client, got %d: %s", resp.Code, resp.Body)
+	}
+
+	return resp.Body.Bytes()
+}
+
+func Test_app_registerOAuthClient(t *testing.T) {
+	var tests = []struct {
+		name               string
+		requestBody        string
+		expectedStatusCode int
+	}{
+		{"valid", `{"name":"SPA","redirect_uris":["https://app.example.com/callback"],"scopes":["openid"]}`, http.StatusCreated},
+		{"native app", `{"name":"CLI","redirect_uris":["http://127.0.0.1:9000/callback","com.example.app:/callback"]}`, http.StatusCreated},
+		{"service", `{"name":"Reporting","scopes":["users:read"],"confidential":true}`, http.StatusCreated},
+		{"no name", `{"redirect_uris":["https://app.example.com/callback"]}`, http.StatusBadRequest},
+		{"no redirect URIs", `{"name":"SPA"}`, http.StatusBadRequest},
+		{"relative redirect URI", `{"name":"SPA","redirect_uris":["/callback"]}`, http.StatusBadRequest},
+		{"plain http redirect URI", `{"name":"SPA","redirect_uris":["http://app.example.com/callback"]}`, http.StatusBadRequest},
+		{"redirect URI with fragment", `{"name":"SPA","redirect_uris":["https://app.example.com/callback#x"]}`, http.StatusBadRequest},
+		{"scope with space", `{"name":"SPA","redirect_uris":["https://app.example.com/callback"],"scopes":["a b"]}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/admin/oauth/clients", strings.NewReader(test.requestBody))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.registerOAuthClient).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+}
+
+func Test_app_authorize(t *testing.T) {
+	client := registerTestClient(t, `{"name":"SPA","redirect_uris":["https://app.example.com/callback"],"scopes":["openid","profile"]}`)
+
+	valid := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	}
+
+	with := func(key, value string) url.Values {
+		query := url.Values{}
+
+		for k, v := range valid {
+			query[k] = v
+		}
+
+		query.Set(key, value)
+
+		return query
+	}
+
+	var tests = []struct {
+		name               string
+		query              url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"unknown client", with("client_id", "nope"), http.StatusBadRequest, ""},
+		{"unregistered redirect URI", with("redirect_uri", "https://evil.example.com/callback"), http.StatusBadRequest, ""},
+		{"wrong response type", with("response_type", "token"), http.StatusFound, "https://app.example.com/callback?error=unsupported_response_type"},
+		{"no code challenge", with("code_challenge", ""), http.StatusFound, "https://app.example.com/callback?error=invalid_request"},
+		{"plain code challenge", with("code_challenge_method", "plain"), http.StatusFound, "https://app.example.com/callback?error=invalid_request"},
+		{"scope not allowed", with("scope", "openid admin"), http.StatusFound, "https://app.example.com/callback?error=invalid_scope"},
+		{"default redirect URI", with("redirect_uri", ""), http.StatusFound, app.BaseURL + "/authorize.html?"},
+		{"valid", valid, http.StatusFound, app.BaseURL + "/authorize.html?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/oauth/authorize?"+test.query.Encode(), nil)
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.authorize).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if !strings.HasPrefix(resp.Header().Get("Location"), test.expectedLocation) {
+				t.Errorf("%s expected redirect to %s, got %s", test.name, test.expectedLocation, resp.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func Test_app_authorizationCodeFlow(t *testing.T) {
+	client := registerTestClient(t, `{"name":"SPA","redirect_uris":["https://app.example.com/callback"],"scopes":["openid"]}`)
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	mux := app.Routes()
+
+	// approve posts the authorization request back as the login page would
+	approve := func(approve string) map[string]any {
+		body := `{"response_type":"code","client_id":"` + client.ClientID + `","redirect_uri":"https://app.example.com/callback",` +
+			`"scope":"openid","state":"xyz","code_challenge":"` + challenge + `","code_challenge_method":"S256"` + approve + `}`
+
+		req, _ := http.NewRequest("POST", "/oauth/authorize", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		var result map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+
+		return result
+	}
+
+	codeFrom := func(result map[string]any) string {
+		redirect, _ := result["redirect_to"].(string)
+		u, _ := url.Parse(redirect)
+
+		if u == nil || u.Query().Get("state") != "xyz" {
+			t.Fatalf("expected a redirect carrying the state, got %v", result)
+		}
+
+		return u.Query().Get("code")
+	}
+
+	if result := approve(""); result["consent_required"] != true {
+		t.Fatalf("expected to be asked for consent, got %v", result)
+	}
+
+	if result := approve(`,"approve":false`); !strings.Contains(result["redirect_to"].(string), "error=access_denied") {
+		t.Errorf("expected access_denied redirect, got %v", result)
+	}
+
+	if code := codeFrom(approve(`,"approve":true`)); code == "" {
+		t.Fatalf("expected a code after approving")
+	}
+
+	// consent is remembered
+	code := codeFrom(approve(""))
+
+	if code == "" {
+		t.Fatalf("expected a code without asking for consent again")
+	}
+
+	exchange := func(form url.Values) (int, oauthTokenResponse) {
+		req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		var tokenResponse oauthTokenResponse
+		_ = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+
+		return resp.Code, tokenResponse
+	}
+
+	form := func(code, redirectURI, codeVerifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {client.ClientID},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {codeVerifier},
+		}
+	}
+
+	wrongVerifierCode := codeFrom(approve(""))
+	wrongRedirectCode := codeFrom(approve(""))
+
+	var tests = []struct {
+		name               string
+		form               url.Values
+		expectedStatusCode int
+	}{
+		{"unsupported grant", url.Values{"grant_type": {"password"}}, http.StatusBadRequest},
+		{"unknown client", url.Values{"grant_type": {"authorization_code"}, "client_id": {"nope"}}, http.StatusUnauthorized},
+		{"wrong verifier", form(wrongVerifierCode, "https://app.example.com/callback", strings.Repeat("a", 43)), http.StatusBadRequest},
+		{"wrong redirect URI", form(wrongRedirectCode, "https://app.example.com/other", verifier), http.StatusBadRequest},
+		{"unknown code", form("not-a-code", "https://app.example.com/callback", verifier), http.StatusBadRequest},
+		{"valid", form(code, "https://app.example.com/callback", verifier), http.StatusOK},
+		{"code reused", form(code, "https://app.example.com/callback", verifier), http.StatusBadRequest},
+	}
+
+	var issued oauthTokenResponse
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, tokenResponse := exchange(test.form)
+
+			if test.expectedStatusCode != status {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, status)
+			}
+
+			if status == http.StatusOK {
+				issued = tokenResponse
+			}
+		})
+	}
+
+	if issued.AccessToken == "" || issued.TokenType != "Bearer" || issued.Scope != "openid" {
+		t.Fatalf("unexpected token response: %+v", issued)
+	}
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.AccessToken)
+	resp := httptest.NewRecorder()
+
+	mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected the issued access token to work, got status code %d", resp.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.AccessToken)
+	resp = httptest.NewRecorder()
+
+	mux.ServeHTTP(resp, req)
+
+	var sessions []data.Session
+	_ = json.NewDecoder(resp.Body).Decode(&sessions)
+
+	current := slices.IndexFunc(sessions, func(session data.Session) bool { return session.Current })
+
+	if current < 0 || sessions[current].UserAgent != "SPA" {
+		t.Errorf("expected the exchange to start a session named after the client, got %+v", sessions)
+	}
+
+	// the user is an admin, but only granted the openid scope, which carries no permissions
+	claims, err := app.validateToken(issued.AccessToken, tokenTypeAccess)
+
+	if err != nil || claims.ClientID != client.ClientID || claims.Scope != "openid" || len(claims.Permissions) != 0 {
+		t.Errorf("expected the access token to be limited to the granted scope, got %+v", claims)
+	}
+
+	other := registerTestClient(t, `{"name":"Other","redirect_uris":["https://other.example.com/callback"],"scopes":["openid"]}`)
+
+	refresh := func(clientID string) url.Values {
+		return url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {issued.RefreshToken}}
+	}
+
+	if status, _ := exchange(refresh("nope")); status != http.StatusUnauthorized {
+		t.Errorf("expected an unknown client not to refresh tokens, got status code %d", status)
+	}
+
+	if status, _ := exchange(refresh(other.ClientID)); status != http.StatusBadRequest {
+		t.Errorf("expected another client not to refresh tokens, got status code %d", status)
+	}
+
+	status, refreshed := exchange(refresh(client.ClientID))
+
+	if status != http.StatusOK || refreshed.AccessToken == "" {
+		t.Fatalf("expected to refresh tokens, got status code %d", status)
+	}
+
+	claims, err = app.validateToken(refreshed.AccessToken, tokenTypeAccess)
+
+	if err != nil || claims.ClientID != client.ClientID || claims.Scope != "openid" || len(claims.Permissions) != 0 {
+		t.Errorf("expected the refreshed access token to keep the granted scope, got %+v", claims)
+	}
+}
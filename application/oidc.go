@@ -0,0 +1,127 @@
+package application
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"time"
+)
+
+const tokenTypeID = "ID"
+
+// scopeOpenID marks an authorization request as an OpenID Connect login, which gets an ID token
+const scopeOpenID = "openid"
+
+// oidcScopes are the OpenID Connect scopes. Any client may ask for them, whatever scopes it was
+// registered with.
+var oidcScopes = []string{scopeOpenID, "profile", "email"}
+
+var idTokenExpiry = time.Minute * 15
+
+// discoveryDocument is the OpenID Connect provider configuration. Client libraries read it to find
+// our endpoints and keys from the issuer URL alone.
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// userInfo holds the standard OpenID Connect claims we have for a user
+type userInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func newUserInfo(user *data.User) userInfo {
+	return userInfo{
+		Subject:       fmt.Sprint(user.ID),
+		Name:          fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}
+}
+
+// openIDConfiguration serves the discovery document. The issuer is BaseURL, since clients
+// check it matches the URL they fetched the document from; ID tokens are issued by BaseURL too.
+func (app *Application) openIDConfiguration(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Cache-Control", "public, max-age=300")
+	_ = app.writeJSON(resp, http.StatusOK, discoveryDocument{
+		Issuer:                            app.BaseURL,
+		AuthorizationEndpoint:             app.BaseURL + "/oauth/authorize",
+		TokenEndpoint:                     app.BaseURL + "/oauth/token",
+		UserInfoEndpoint:                  app.BaseURL + "/userinfo",
+		JWKSURI:                           app.BaseURL + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             app.BaseURL + "/oauth/introspect",
+		RevocationEndpoint:                app.BaseURL + "/oauth/revoke",
+		ScopesSupported:                   oidcScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  app.Keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce",
+			"name", "given_name", "family_name", "email", "email_verified",
+		},
+	})
+}
+
+// userinfo returns the standard claims for the user the access token was issued to
+func (app *Application) userinfo(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(resp, http.StatusOK, newUserInfo(user))
+}
+
+// issueIDToken creates an OpenID Connect ID token, telling the client who logged in. Unlike our
+// access tokens it is issued by BaseURL, to match the discovery document, and its audience is the
+// client. Clients verify it against our published keys, so an HMAC secret won't do here; configure
+// a key pair when using OpenID Connect.
+func (app *Application) issueIDToken(user *data.User, clientID, nonce string) (string, error) {
+	info := newUserInfo(user)
+
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeID
+	claims["iss"] = app.BaseURL
+	claims["sub"] = info.Subject
+	claims["aud"] = clientID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(idTokenExpiry).Unix()
+	claims["name"] = info.Name
+	claims["given_name"] = info.GivenName
+	claims["family_name"] = info.FamilyName
+	claims["email"] = info.Email
+	claims["email_verified"] = info.EmailVerified
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return app.signToken(claims)
+}
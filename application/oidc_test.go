@@ -0,0 +1,183 @@
+package application
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_openIDConfiguration(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	resp := httptest.NewRecorder()
+
+	app.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, got %d", resp.Code)
+	}
+
+	var config discoveryDocument
+	_ = json.NewDecoder(resp.Body).Decode(&config)
+
+	if config.Issuer != app.BaseURL {
+		t.Errorf("expected issuer %s, got %s", app.BaseURL, config.Issuer)
+	}
+
+	if config.TokenEndpoint != app.BaseURL+"/oauth/token" || config.UserInfoEndpoint != app.BaseURL+"/userinfo" ||
+		config.JWKSURI != app.BaseURL+"/.well-known/jwks.json" {
+		t.Errorf("unexpected endpoints: %+v", config)
+	}
+
+	if len(config.IDTokenSigningAlgValuesSupported) != 1 || config.IDTokenSigningAlgValuesSupported[0] != "HS256" {
+		t.Errorf("expected the signing algorithm of our key, got %v", config.IDTokenSigningAlgValuesSupported)
+	}
+}
+
+func Test_app_userinfo(t *testing.T) {
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	client := registerTestClient(t, `{"name":"Reporting","scopes":["users:read"],"confidential":true}`)
+	machineToken, _ := app.issueClientToken(&client, "users:read")
+
+	var tests = []struct {
+		name               string
+		method             string
+		token              string
+		expectedStatusCode int
+	}{
+		{"no token", "GET", "", http.StatusUnauthorized},
+		{"machine token", "GET", machineToken, http.StatusUnauthorized},
+		{"get", "GET", tokens.AccessToken, http.StatusOK},
+		{"post", "POST", tokens.AccessToken, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, "/userinfo", nil)
+
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			resp := httptest.NewRecorder()
+
+			app.Routes().ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var info userInfo
+			_ = json.NewDecoder(resp.Body).Decode(&info)
+
+			if info.Subject != "1" || info.Email != "admin@example.com" || info.GivenName != "Admin" || info.FamilyName != "User" {
+				t.Errorf("%s returned unexpected claims: %+v", test.name, info)
+			}
+		})
+	}
+}
+
+func Test_app_idToken(t *testing.T) {
+	client := registerTestClient(t, `{"name":"Dashboard","redirect_uris":["https://dashboard.example.com/callback"]}`)
+
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	mux := app.Routes()
+
+	// exchange logs in through the authorization code flow, and returns the token response
+	exchange := func(scope string) oauthTokenResponse {
+		body := `{"response_type":"code","client_id":"` + client.ClientID + `","scope":"` + scope + `",` +
+			`"nonce":"n-0S6_WzA2Mj","code_challenge":"` + challenge + `","code_challenge_method":"S256","approve":true}`
+
+		req, _ := http.NewRequest("POST", "/oauth/authorize", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		var authorization authorizationResponse
+		_ = json.NewDecoder(resp.Body).Decode(&authorization)
+
+		redirect, _ := url.Parse(authorization.RedirectTo)
+
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {client.ClientID},
+			"code":          {redirect.Query().Get("code")},
+			"redirect_uri":  {"https://dashboard.example.com/callback"},
+			"code_verifier": {verifier},
+		}
+
+		req, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp = httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status code 200 exchanging the code, got %d: %s", resp.Code, resp.Body)
+		}
+
+		var tokenResponse oauthTokenResponse
+		_ = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+
+		return tokenResponse
+	}
+
+	if issued := exchange(""); issued.IDToken != "" {
+		t.Errorf("expected no ID token without the openid scope")
+	}
+
+	issued := exchange("openid profile email")
+
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(issued.IDToken, claims, app.keyFunc,
+		jwt.WithIssuer(app.BaseURL), jwt.WithAudience(client.ClientID), jwt.WithIssuedAt())
+
+	if err != nil {
+		t.Fatalf("ID token did not verify: %s", err)
+	}
+
+	expected := map[string]any{
+		"sub":         "1",
+		"nonce":       "n-0S6_WzA2Mj",
+		"email":       "admin@example.com",
+		"given_name":  "Admin",
+		"family_name": "User",
+	}
+
+	for claim, value := range expected {
+		if claims[claim] != value {
+			t.Errorf("expected %s to be %v, got %v", claim, value, claims[claim])
+		}
+	}
+
+	// an ID token says who logged in; it must not be usable as an access token
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.IDToken)
+	resp := httptest.NewRecorder()
+
+	mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code 401 using an ID token as an access token, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package application
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+
+	// maxPage keeps the offset a page turns into small enough that it can't overflow, and that
+	// the database isn't asked to skip millions of rows
+	maxPage = 10000
+)
+
+// pageLinks are the URLs of the pages either side of this one, if there are any
+type pageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// usersPage is one page of a list of users, or of search results, with what a client needs to
+// fetch the rest
+type usersPage[T any] struct {
+	Users []T       `json:"users"`
+	Total int       `json:"total"`
+	Page  int       `json:"page"`
+	Limit int       `json:"limit"`
+	Links pageLinks `json:"links"`
+}
+
+// readPage reads the page and limit query parameters. Pages are numbered from 1.
+func readPage(query url.Values) (page, limit int, err error) {
+	page, limit = 1, defaultPageSize
+
+	if value := query.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+
+		if err != nil || page < 1 || page > maxPage {
+			return 0, 0, fmt.Errorf("Page must be between 1 and %d", maxPage)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("Limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	return page, limit, nil
+}
+
+// pageLinks returns the links to the pages either side of page, keeping the rest of the request's query
+func (app *Application) pageLinks(req *http.Request, page, limit, total int) pageLinks {
+	link := func(page int) string {
+		query := req.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(limit))
+
+		return app.BaseURL + req.URL.Path + "?" + query.Encode()
+	}
+
+	var links pageLinks
+
+	if page*limit < total {
+		links.Next = link(page + 1)
+	}
+
+	if page > 1 {
+		// a page past the end links back to the last page
+		links.Prev = link(min(page-1, max((total+limit-1)/limit, 1)))
+	}
+
+	return links
+}
@@ -0,0 +1,123 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const purposePasswordReset = "password-reset"
+
+var passwordResetExpiry = time.Hour
+
+type forgottenPassword struct {
+	Email string `json:"email"`
+}
+
+type passwordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// forgotPassword emails a single-use password reset link. It responds the same way whether or
+// not the email address belongs to a user, so it can't be used to find out who has an account.
+func (app *Application) forgotPassword(resp http.ResponseWriter, req *http.Request) {
+	var payload forgottenPassword
+
+	err := app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByEmail(payload.Email)
+
+	if err == nil {
+		err = app.sendPasswordResetEmail(user)
+
+		if err != nil {
+			log.Println("Error sending password reset email:", err)
+		}
+	}
+
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+func (app *Application) sendPasswordResetEmail(user *data.User) error {
+	token, err := randomToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = app.DB.InsertUserToken(data.UserToken{
+		UserID:    user.ID,
+		Purpose:   purposePasswordReset,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetExpiry),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password.html?token=%s", app.BaseURL, url.QueryEscape(token))
+
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"If it was you, follow this link within %s to choose a new one:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n", user.FirstName, passwordResetExpiry, link),
+	})
+}
+
+// resetPassword sets a new password using a token from a password reset email. Since the old
+// password may have been compromised, every existing session for the user is ended.
+func (app *Application) resetPassword(resp http.ResponseWriter, req *http.Request) {
+	var payload passwordReset
+
+	err := app.readJSON(resp, req, &payload)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	var errs validationErrors
+	validatePassword(&errs, "password", payload.Password)
+
+	if len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(hashToken(payload.Token), purposePasswordReset)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Invalid or expired token"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.ResetPassword(token.UserID, payload.Password)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.RevokeUserRefreshTokens(token.UserID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
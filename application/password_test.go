@@ -0,0 +1,97 @@
+package application
+
+import (
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// linkToken pulls the token query parameter out of the last link emailed to an address
+func linkToken(t *testing.T, to string) string {
+	msg, ok := app.Mailer.(*mailer.MemoryMailer).Last(to)
+
+	if !ok {
+		t.Fatalf("no email sent to %s", to)
+	}
+
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(msg.Body)
+
+	if match == nil {
+		t.Fatalf("no token in email to %s: %s", to, msg.Body)
+	}
+
+	token, _ := url.QueryUnescape(match[1])
+
+	return token
+}
+
+func Test_app_forgotPassword(t *testing.T) {
+	var tests = []struct {
+		name               string
+		requestBody        string
+		expectedStatusCode int
+		expectEmail        bool
+	}{
+		{"known user", `{"email":"admin@example.com"}`, http.StatusAccepted, true},
+		{"unknown user", `{"email":"nobody@example.com"}`, http.StatusAccepted, false},
+		{"not JSON", `I'm not JSON`, http.StatusBadRequest, false},
+	}
+
+	sentMail := app.Mailer.(*mailer.MemoryMailer)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sentBefore := len(sentMail.Messages())
+
+			req, _ := http.NewRequest("POST", "/password/forgot", strings.NewReader(test.requestBody))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.forgotPassword).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			sent := len(sentMail.Messages()) > sentBefore
+
+			if test.expectEmail != sent {
+				t.Errorf("%s expected an email to be sent: %t, but sent: %t", test.name, test.expectEmail, sent)
+			}
+		})
+	}
+}
+
+func Test_app_resetPassword(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/password/forgot", strings.NewReader(`{"email":"admin@example.com"}`))
+	http.HandlerFunc(app.forgotPassword).ServeHTTP(httptest.NewRecorder(), req)
+
+	token := linkToken(t, "admin@example.com")
+
+	var tests = []struct {
+		name               string
+		requestBody        string
+		expectedStatusCode int
+	}{
+		{"missing password", `{"token":"` + token + `"}`, http.StatusUnprocessableEntity},
+		{"wrong token", `{"token":"not-the-token","password":"new-secret"}`, http.StatusBadRequest},
+		{"valid token", `{"token":"` + token + `","password":"new-secret"}`, http.StatusNoContent},
+		{"token already used", `{"token":"` + token + `","password":"another-secret"}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/password/reset", strings.NewReader(test.requestBody))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.resetPassword).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// userDocument is the JSON document a patch to a user is applied to. It is the user as the API
+// shows them, except that every field is present, so a patch can test or replace any of them.
+type userDocument struct {
+	ID              int        `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	IsAdmin         int        `json:"is_admin"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+func newUserDocument(user *data.User) userDocument {
+	return userDocument{
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		IsAdmin:         user.IsAdmin,
+		EmailVerified:   user.EmailVerified,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}
+}
+
+// patchableUserFields are the fields of a user a patch may change. A patch may still test the
+// others, e.g. that id is what the client expects.
+var patchableUserFields = []string{"first_name", "last_name", "email", "is_admin"}
+
+// isUserFieldType reports whether value, decoded from JSON, has the right type for a patchable field.
+// The values themselves are checked by validateUser once the patch is applied.
+func isUserFieldType(field string, value any) bool {
+	if field == "is_admin" {
+		number, ok := value.(float64)
+		return ok && number == float64(int(number))
+	}
+
+	_, ok := value.(string)
+
+	return ok
+}
+
+// patchUser changes some of a user's fields with either a JSON Merge Patch (RFC 7396) or a JSON
+// Patch (RFC 6902), applied to the user's userDocument. Fields the patch leaves alone keep their
+// values. It responds with the updated user. An If-Match header makes the patch conditional on the
+// user's ETag.
+func (app *Application) patchUser(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	if contentType != contentTypeMergePatch && contentType != contentTypeJSONPatch {
+		resp.Header().Set("Accept-Patch", contentTypeMergePatch+", "+contentTypeJSONPatch)
+		app.errorJSON(resp, fmt.Errorf("Content-Type must be %s or %s", contentTypeMergePatch, contentTypeJSONPatch), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("User not found"), http.StatusNotFound)
+		return
+	}
+
+	if !app.checkIfMatch(resp, req, user) {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, 1024*1024))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	original, err := json.Marshal(newUserDocument(user))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := applyPatch(contentType, original, patch)
+
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		app.errorJSON(resp, err, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, fmt.Errorf("Invalid patch: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := changedFields(original, patched)
+
+	var invalid validationErrors
+
+	if errors.As(err, &invalid) {
+		app.errorJSON(resp, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	previous := *user
+	var changed []string
+
+	for field, value := range changes {
+		changed = append(changed, field)
+		switch field {
+		case "first_name":
+			user.FirstName = value.(string)
+		case "last_name":
+			user.LastName = value.(string)
+		case "email":
+			user.Email = value.(string)
+		case "is_admin":
+			user.IsAdmin = int(value.(float64))
+		}
+	}
+
+	// only the fields being changed are checked, so a patch isn't refused over values it didn't set
+	if errs := validateUser(user).only(changed...); len(errs) > 0 {
+		app.errorJSON(resp, errs, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, ok := changes["is_admin"]; ok && !canSetAdmin(req) {
+		app.errorJSON(resp, errSetAdminForbidden, http.StatusForbidden)
+		return
+	}
+
+	// the update is conditional on the version we patched, so a concurrent change isn't overwritten
+	if len(changes) > 0 {
+		err = app.DB.UpdateUser(*user)
+
+		if isVersionConflict(err) {
+			app.writeVersionConflict(resp, req)
+			return
+		}
+
+		if err != nil {
+			app.errorJSON(resp, err, http.StatusInternalServerError)
+			return
+		}
+
+		user.Version++
+	}
+
+	if user.Email != previous.Email {
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+
+	app.sendVerificationEmailIfChanged(&previous, user)
+
+	resp.Header().Set("ETag", userETag(user))
+	_ = app.writeJSON(resp, http.StatusOK, user)
+}
+
+func applyPatch(contentType string, document, patch []byte) ([]byte, error) {
+	if contentType == contentTypeMergePatch {
+		return jsonpatch.MergePatch(document, patch)
+	}
+
+	operations, err := jsonpatch.DecodePatch(patch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return operations.Apply(document)
+}
+
+// changedFields compares a user's JSON before and after a patch, returning the new values of the
+// fields that changed. If the patch removes a field, changes one that isn't patchable, adds one users
+// don't have or gives one a value of the wrong type, it returns validationErrors naming each field.
+func changedFields(original, patched []byte) (map[string]any, error) {
+	var before, after map[string]any
+
+	_ = json.Unmarshal(original, &before)
+
+	if err := json.Unmarshal(patched, &after); err != nil || after == nil {
+		return nil, errors.New("Invalid patch: the result is not a user")
+	}
+
+	changes := map[string]any{}
+	var errs validationErrors
+
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			errs.add(field, "is not a field of users")
+		}
+	}
+
+	for field, value := range before {
+		newValue, ok := after[field]
+
+		switch {
+		case ok && reflect.DeepEqual(value, newValue):
+			continue
+		case !slices.Contains(patchableUserFields, field):
+			errs.add(field, "cannot be changed")
+		case !ok:
+			errs.add(field, "cannot be removed")
+		case !isUserFieldType(field, newValue):
+			errs.add(field, "has the wrong type")
+		default:
+			changes[field] = newValue
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].Field < errs[j].Field
+		})
+
+		return nil, errs
+	}
+
+	return changes, nil
+}
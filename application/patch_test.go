@@ -0,0 +1,261 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_app_patchUser(t *testing.T) {
+	var tests = []struct {
+		name               string
+		userId             string
+		contentType        string
+		patch              string
+		expectedStatusCode int
+		expectedUser       data.User
+		expectedError      string
+	}{
+		{
+			"merge patch one field",
+			"1",
+			contentTypeMergePatch,
+			`{"first_name":"Administrator"}`,
+			http.StatusOK,
+			data.User{ID: 1, FirstName: "Administrator", LastName: "User", Email: "admin@example.com"},
+			"",
+		},
+		{
+			"merge patch with charset",
+			"1",
+			contentTypeMergePatch + "; charset=utf-8",
+			`{"last_name":"Person","is_admin":1}`,
+			http.StatusOK,
+			data.User{ID: 1, FirstName: "Admin", LastName: "Person", Email: "admin@example.com", IsAdmin: 1},
+			"",
+		},
+		{
+			"merge patch changing nothing",
+			"1",
+			contentTypeMergePatch,
+			`{}`,
+			http.StatusOK,
+			data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"},
+			"",
+		},
+		{
+			"json patch",
+			"1",
+			contentTypeJSONPatch,
+			`[{"op":"test","path":"/id","value":1},{"op":"replace","path":"/email","value":"new@example.com"}]`,
+			http.StatusOK,
+			data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "new@example.com"},
+			"",
+		},
+		{
+			"json patch copying a field",
+			"1",
+			contentTypeJSONPatch,
+			`[{"op":"copy","from":"/last_name","path":"/first_name"}]`,
+			http.StatusOK,
+			data.User{ID: 1, FirstName: "User", LastName: "User", Email: "admin@example.com"},
+			"",
+		},
+		{
+			"json patch test fails",
+			"1",
+			contentTypeJSONPatch,
+			`[{"op":"test","path":"/first_name","value":"Someone"},{"op":"replace","path":"/first_name","value":"Jack"}]`,
+			http.StatusConflict,
+			data.User{},
+			"",
+		},
+		{
+			"removing a field",
+			"1",
+			contentTypeMergePatch,
+			`{"last_name":null}`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`"field":"last_name","message":"cannot be removed"`,
+		},
+		{
+			"changing id",
+			"1",
+			contentTypeJSONPatch,
+			`[{"op":"replace","path":"/id","value":2}]`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`"field":"id","message":"cannot be changed"`,
+		},
+		{
+			"marking email verified",
+			"1",
+			contentTypeMergePatch,
+			`{"email_verified":true}`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`"field":"email_verified","message":"cannot be changed"`,
+		},
+		{
+			"unknown field",
+			"1",
+			contentTypeMergePatch,
+			`{"password":"secret"}`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`"field":"password","message":"is not a field of users"`,
+		},
+		{
+			"every invalid field is reported",
+			"1",
+			contentTypeMergePatch,
+			`{"first_name":"","email":"not an email","is_admin":2}`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`[{"field":"first_name","message":"is required"},{"field":"email","message":"must be a valid email address"},{"field":"is_admin","message":"must be 0 or 1"}]`,
+		},
+		{
+			"wrong type",
+			"1",
+			contentTypeMergePatch,
+			`{"last_name":7}`,
+			http.StatusUnprocessableEntity,
+			data.User{},
+			`"field":"last_name","message":"has the wrong type"`,
+		},
+		{"not JSON", "1", contentTypeMergePatch, `{first_name`, http.StatusBadRequest, data.User{}, ""},
+		{"bad operation", "1", contentTypeJSONPatch, `[{"op":"frobnicate","path":"/email"}]`, http.StatusBadRequest, data.User{}, ""},
+		{"plain JSON", "1", "application/json", `{"first_name":"Administrator"}`, http.StatusUnsupportedMediaType, data.User{}, ""},
+		{"unknown user", "5", contentTypeMergePatch, `{"first_name":"Administrator"}`, http.StatusNotFound, data.User{}, ""},
+		{"bad URL param", "x", contentTypeMergePatch, `{"first_name":"Administrator"}`, http.StatusBadRequest, data.User{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/users/"+test.userId, strings.NewReader(test.patch))
+			req.Header.Set("Content-Type", test.contentType)
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userId", test.userId)
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx)
+			ctx = context.WithValue(ctx, claimsContextKey, &Claims{Permissions: []string{permUsersWrite, permRolesManage}})
+			req = req.WithContext(ctx)
+
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.patchUser).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d: %s", test.name, test.expectedStatusCode, resp.Code, resp.Body)
+			}
+
+			if resp.Code == http.StatusUnsupportedMediaType && resp.Header().Get("Accept-Patch") == "" {
+				t.Errorf("%s expected an Accept-Patch header", test.name)
+			}
+
+			if resp.Code != http.StatusOK {
+				if test.expectedError != "" && !strings.Contains(resp.Body.String(), test.expectedError) {
+					t.Errorf("%s expected error %q, got %s", test.name, test.expectedError, resp.Body)
+				}
+
+				return
+			}
+
+			var user data.User
+			_ = json.NewDecoder(resp.Body).Decode(&user)
+
+			if user.ID != test.expectedUser.ID || user.FirstName != test.expectedUser.FirstName ||
+				user.LastName != test.expectedUser.LastName || user.Email != test.expectedUser.Email ||
+				user.IsAdmin != test.expectedUser.IsAdmin {
+				t.Errorf("%s expected %+v, got %+v", test.name, test.expectedUser, user)
+			}
+		})
+	}
+}
+
+func Test_app_setAdminWithoutRolesManage(t *testing.T) {
+	adminApp := app
+	adminApp.DB = &dbrepo.TestDBRepo{}
+
+	mux := adminApp.Routes()
+
+	// can edit users, but not hand out roles
+	token, _ := adminApp.signToken(jwt.MapClaims{
+		"typ":         tokenTypeAccess,
+		"sub":         "3",
+		"aud":         app.Domain,
+		"iss":         app.Domain,
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"permissions": []string{permUsersWrite},
+	})
+
+	var tests = []struct {
+		name               string
+		method             string
+		route              string
+		contentType        string
+		json               string
+		expectedStatusCode int
+	}{
+		{"patch", "PATCH", "/users/1", contentTypeMergePatch, `{"is_admin":1}`, http.StatusForbidden},
+		{"json patch", "PATCH", "/users/1", contentTypeJSONPatch, `[{"op":"replace","path":"/is_admin","value":1}]`, http.StatusForbidden},
+		{"update", "PATCH", "/users/", "application/json", `{"id":1,"first_name":"Admin","last_name":"User","email":"admin@example.com","is_admin":1}`, http.StatusForbidden},
+		{"create", "PUT", "/users/", "application/json", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com","password":"a good password","is_admin":1}`, http.StatusForbidden},
+		{"patch other fields", "PATCH", "/users/1", contentTypeMergePatch, `{"first_name":"Administrator"}`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.route, strings.NewReader(test.json))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", test.contentType)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		if test.expectedStatusCode != resp.Code {
+			t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+		}
+	}
+}
+
+// unknownUserRepo can't find any user, but would still update one
+type unknownUserRepo struct {
+	*dbrepo.TestDBRepo
+	updated bool
+}
+
+func (m *unknownUserRepo) GetUser(id int) (*data.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *unknownUserRepo) UpdateUser(u data.User) error {
+	m.updated = true
+	return nil
+}
+
+func Test_app_updateUnknownUser(t *testing.T) {
+	repo := &unknownUserRepo{TestDBRepo: &dbrepo.TestDBRepo{}}
+
+	updateApp := app
+	updateApp.DB = repo
+
+	req, _ := http.NewRequest("PATCH", "/users/", strings.NewReader(`{"id":1,"first_name":"Admin","last_name":"User","email":"admin@example.com","is_admin":1}`))
+	req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, &Claims{Permissions: []string{permUsersWrite}}))
+	resp := httptest.NewRecorder()
+
+	http.HandlerFunc(updateApp.updateUser).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound || repo.updated {
+		t.Errorf("expected 404 without updating a user who can't be looked up, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package application
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const roleAdmin = "admin"
+
+// permissions checked by the routes; roles grant these through the role_permissions table
+const (
+	permUsersRead      = "users:read"
+	permUsersWrite     = "users:write"
+	permUsersDelete    = "users:delete"
+	permRolesManage    = "roles:manage"
+	permSessionsRevoke = "sessions:revoke"
+	permClientsManage  = "clients:manage"
+	permImpersonate    = "users:impersonate"
+)
+
+var errSetAdminForbidden = errors.New("Changing is_admin requires the roles:manage permission")
+
+type roleAssignment struct {
+	Role string `json:"role"`
+}
+
+// userAuthorization returns the names of a user's roles and the permissions those roles grant.
+// The is_admin column predates roles, so it still counts as having the admin role.
+func (app *Application) userAuthorization(user *data.User) ([]string, []string, error) {
+	assigned, err := app.DB.GetUserRoles(user.ID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isAdminRole := func(role *data.Role) bool { return role.Name == roleAdmin }
+
+	if user.IsAdmin == 1 && !slices.ContainsFunc(assigned, isAdminRole) {
+		adminRole, err := app.DB.GetRole(roleAdmin)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		assigned = append(assigned, adminRole)
+	}
+
+	roles := []string{}
+	permissions := []string{}
+
+	for _, role := range assigned {
+		roles = append(roles, role.Name)
+
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	slices.Sort(permissions)
+
+	return roles, permissions, nil
+}
+
+// canSetAdmin reports whether the caller may change a user's is_admin flag. The flag grants the
+// admin role, so it needs the same permission as assigning roles.
+func canSetAdmin(req *http.Request) bool {
+	claims, ok := claimsFromContext(req.Context())
+
+	return ok && claims.HasPermission(permRolesManage)
+}
+
+// HasPermission reports whether the token grants a permission. Tokens issued to OAuth clients have
+// no user and so no roles; their scopes name the permissions they grant instead.
+func (c *Claims) HasPermission(permission string) bool {
+	if c.IsClient() {
+		return slices.Contains(strings.Fields(c.Scope), permission)
+	}
+
+	return slices.Contains(c.Permissions, permission)
+}
+
+func (app *Application) allRoles(resp http.ResponseWriter, req *http.Request) {
+	roles, err := app.DB.AllRoles()
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, roles)
+}
+
+func (app *Application) getUserRoles(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	roles, permissions, err := app.userAuthorization(user)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, map[string][]string{
+		"roles":       roles,
+		"permissions": permissions,
+	})
+}
+
+// assignRole gives a user a role. Like any change to a user's roles, it takes effect the next time
+// the user logs in or refreshes their token.
+func (app *Application) assignRole(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	var assignment roleAssignment
+
+	err = app.readJSON(resp, req, &assignment)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err = app.DB.GetRole(assignment.Role); err != nil {
+		app.errorJSON(resp, errors.New("Unknown role"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.AssignRole(userId, assignment.Role)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) removeRole(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.RemoveRole(userId, chi.URLParam(req, "role"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package application
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_app_userAuthorization(t *testing.T) {
+	_ = app.DB.AssignRole(3, "support")
+
+	tests := []struct {
+		name                string
+		user                data.User
+		expectedRoles       []string
+		expectedPermissions []string
+	}{
+		{"no roles", data.User{ID: 2}, []string{}, []string{}},
+		{"legacy is_admin", data.User{ID: 1, IsAdmin: 1}, []string{"admin"}, []string{"clients:manage", "roles:manage", "sessions:revoke", "users:delete", "users:impersonate", "users:read", "users:write"}},
+		{"support role", data.User{ID: 3}, []string{"support"}, []string{"users:read"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roles, permissions, err := app.userAuthorization(&test.user)
+
+			if err != nil {
+				t.Fatalf("%s got unexpected error: %s", test.name, err)
+			}
+
+			if !slices.Equal(roles, test.expectedRoles) {
+				t.Errorf("%s expected roles %v, got %v", test.name, test.expectedRoles, roles)
+			}
+
+			if !slices.Equal(permissions, test.expectedPermissions) {
+				t.Errorf("%s expected permissions %v, got %v", test.name, test.expectedPermissions, permissions)
+			}
+		})
+	}
+}
+
+func Test_app_roleHandlers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		json               string
+		idParam            string
+		roleParam          string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+	}{
+		{"all roles", "GET", "", "", "", app.allRoles, http.StatusOK},
+		{"assign role", "POST", `{"role":"support"}`, "4", "", app.assignRole, http.StatusNoContent},
+		{"assign unknown role", "POST", `{"role":"superuser"}`, "4", "", app.assignRole, http.StatusBadRequest},
+		{"assign role bad URL param", "POST", `{"role":"support"}`, "x", "", app.assignRole, http.StatusBadRequest},
+		{"assign role invalid json", "POST", `{role:"support"}`, "4", "", app.assignRole, http.StatusBadRequest},
+		{"get user roles", "GET", "", "1", "", app.getUserRoles, http.StatusOK},
+		{"get user roles unknown user", "GET", "", "5", "", app.getUserRoles, http.StatusBadRequest},
+		{"remove role", "DELETE", "", "4", "support", app.removeRole, http.StatusNoContent},
+		{"remove role bad URL param", "DELETE", "", "x", "support", app.removeRole, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, "/", strings.NewReader(test.json))
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userId", test.idParam)
+			chiCtx.URLParams.Add("role", test.roleParam)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+			resp := httptest.NewRecorder()
+
+			test.handler.ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+
+	roles, _ := app.DB.GetUserRoles(4)
+
+	if len(roles) != 0 {
+		t.Errorf("expected the support role to have been removed, got %d roles", len(roles))
+	}
+}
@@ -15,25 +15,117 @@ func (app *Application) Routes() http.Handler {
 
 	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./html/"))))
 
+	// public keys for verifying our tokens
+	mux.Get("/.well-known/jwks.json", app.jwks)
+
+	// OpenID Connect
+	mux.Get("/.well-known/openid-configuration", app.openIDConfiguration)
+	mux.With(app.authRequired).Get("/userinfo", app.userinfo)
+	mux.With(app.authRequired).Post("/userinfo", app.userinfo)
+
 	mux.Route("/web", func(mux chi.Router) {
 		mux.Post("/auth", app.authenticate)
+		mux.Post("/auth/mfa", app.authenticateMFA)
 		mux.Get("/refresh-token", app.refreshUsingCookie)
-		mux.Get("/logout", app.deleteRefreshCookie)
+		mux.Get("/logout", app.logout)
 	})
 
-	// authentication routes - auth handler, refresh
+	// authentication routes - auth handler, refresh, logout
 	mux.Post("/auth", app.authenticate)
+	mux.Post("/auth/mfa", app.authenticateMFA)
+	mux.Post("/auth/magic-link", app.requestMagicLink)
+	mux.Get("/auth/magic-link/verify", app.confirmMagicLink)
+	mux.Post("/auth/magic-link/verify", app.verifyMagicLink)
 	mux.Post("/refresh-token", app.refresh)
+	mux.Post("/logout", app.logout)
+
+	// OAuth2 authorization server; the login page posts approved requests back to /oauth/authorize.
+	// Admins impersonating a user can't approve clients for them, since the client's tokens would
+	// outlive the impersonation and carry no act claim.
+	mux.Get("/oauth/authorize", app.authorize)
+	mux.With(app.authRequired, app.denyImpersonation).Post("/oauth/authorize", app.approveAuthorization)
+	mux.Post("/oauth/token", app.oauthToken)
+	mux.Post("/oauth/introspect", app.introspect)
+	mux.Post("/oauth/revoke", app.revokeToken)
+
+	// forgotten passwords
+	mux.Post("/password/forgot", app.forgotPassword)
+	mux.Post("/password/reset", app.resetPassword)
+
+	// link from the email we send when a user is created or changes their email address
+	mux.Get("/verify-email", app.verifyEmail)
 
 	// protected routes
 	mux.Route("/users", func(mux chi.Router) {
 		mux.Use(app.authRequired)
 
-		mux.Get("/", app.allUsers)
-		mux.Get("/{userId}", app.getUser)
-		mux.Delete("/{userId}", app.deleteUser)
-		mux.Put("/", app.createUser)
-		mux.Patch("/", app.updateUser)
+		mux.With(app.requirePermission(permUsersRead)).Get("/", app.allUsers)
+		mux.With(app.requirePermission(permUsersRead)).Get("/search", app.searchUsers)
+		mux.With(app.requireSelfOrPermission(permUsersRead)).Get("/{userId}", app.getUser)
+		mux.With(app.requirePermission(permUsersDelete)).Delete("/{userId}", app.deleteUser)
+		mux.With(app.requirePermission(permUsersWrite)).Put("/", app.createUser)
+		mux.With(app.requirePermission(permUsersWrite)).Patch("/", app.updateUser)
+		mux.With(app.requirePermission(permUsersWrite)).Patch("/{userId}", app.patchUser)
+
+		mux.With(app.requireSelfOrPermission(permUsersRead)).Get("/{userId}/roles", app.getUserRoles)
+		mux.With(app.requirePermission(permRolesManage)).Post("/{userId}/roles", app.assignRole)
+		mux.With(app.requirePermission(permRolesManage)).Delete("/{userId}/roles/{role}", app.removeRole)
+	})
+
+	// the caller's own account
+	mux.Route("/me", func(mux chi.Router) {
+		mux.Use(app.authRequired)
+
+		// admins impersonating the user, API keys and OAuth clients can look but can't change the account
+		mux.Get("/", app.getMe)
+		mux.Get("/sessions", app.mySessions)
+		mux.Get("/api-keys", app.allAPIKeys)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.denyImpersonation)
+			mux.Use(app.denyAPIKeys)
+			mux.Use(app.denyOAuthClients)
+
+			mux.Patch("/", app.updateMe)
+			mux.Put("/password", app.changeMyPassword)
+
+			// TOTP second factor
+			mux.Post("/mfa", app.enrollMFA)
+			mux.Post("/mfa/confirm", app.confirmMFA)
+			mux.Post("/mfa/recovery-codes", app.regenerateRecoveryCodes)
+			mux.Delete("/mfa", app.disableMFA)
+
+			// where the caller is logged in
+			mux.Delete("/sessions/{sessionId}", app.endMySession)
+
+			// API keys for scripts and other automation
+			mux.Post("/api-keys", app.createAPIKey)
+			mux.Delete("/api-keys/{keyId}", app.revokeAPIKey)
+		})
+	})
+
+	mux.Route("/roles", func(mux chi.Router) {
+		mux.Use(app.authRequired)
+		mux.Use(app.requirePermission(permRolesManage))
+
+		mux.Get("/", app.allRoles)
+	})
+
+	// admin routes
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.authRequired)
+
+		mux.With(app.requirePermission(permUsersRead)).Get("/users/{userId}/sessions", app.userSessions)
+		mux.With(app.requirePermission(permSessionsRevoke)).Delete("/users/{userId}/sessions", app.revokeUserSessions)
+		mux.With(app.requirePermission(permSessionsRevoke)).Delete("/users/{userId}/sessions/{sessionId}", app.endUserSession)
+		mux.With(app.requirePermission(permUsersWrite)).Delete("/users/{userId}/lockout", app.unlockUser)
+		mux.With(app.requirePermission(permUsersRead)).Get("/users/{userId}/audit-log", app.userAuditLog)
+
+		// act as another user, e.g. to see what support tickets describe; every request is audited
+		mux.With(app.requirePermission(permImpersonate), app.denyImpersonation).Post("/impersonate/{userId}", app.impersonate)
+
+		mux.With(app.requirePermission(permClientsManage)).Get("/oauth/clients", app.allOAuthClients)
+		mux.With(app.requirePermission(permClientsManage)).Post("/oauth/clients", app.registerOAuthClient)
 	})
 
 	return mux
@@ -2,7 +2,10 @@ package application
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -14,11 +17,56 @@ func Test_application_routes(t *testing.T) {
 	}{
 		{"/auth", "POST"},
 		{"/refresh-token", "POST"},
+		{"/logout", "POST"},
+		{"/auth/mfa", "POST"},
+		{"/web/auth/mfa", "POST"},
+		{"/auth/magic-link", "POST"},
+		{"/auth/magic-link/verify", "GET"},
+		{"/auth/magic-link/verify", "POST"},
+		{"/password/forgot", "POST"},
+		{"/password/reset", "POST"},
+		{"/verify-email", "GET"},
+		{"/web/logout", "GET"},
+		{"/.well-known/jwks.json", "GET"},
+		{"/.well-known/openid-configuration", "GET"},
+		{"/userinfo", "GET"},
+		{"/userinfo", "POST"},
 		{"/users/", "GET"},
+		{"/users/search", "GET"},
 		{"/users/{userId}", "GET"},
 		{"/users/{userId}", "DELETE"},
 		{"/users/", "PUT"},
 		{"/users/", "PATCH"},
+		{"/users/{userId}", "PATCH"},
+		{"/users/{userId}/roles", "GET"},
+		{"/users/{userId}/roles", "POST"},
+		{"/users/{userId}/roles/{role}", "DELETE"},
+		{"/me/", "GET"},
+		{"/me/", "PATCH"},
+		{"/me/password", "PUT"},
+		{"/me/mfa", "POST"},
+		{"/me/mfa/confirm", "POST"},
+		{"/me/mfa/recovery-codes", "POST"},
+		{"/me/mfa", "DELETE"},
+		{"/me/sessions", "GET"},
+		{"/me/sessions/{sessionId}", "DELETE"},
+		{"/me/api-keys", "GET"},
+		{"/me/api-keys", "POST"},
+		{"/me/api-keys/{keyId}", "DELETE"},
+		{"/roles/", "GET"},
+		{"/admin/users/{userId}/sessions", "GET"},
+		{"/admin/users/{userId}/sessions", "DELETE"},
+		{"/admin/users/{userId}/sessions/{sessionId}", "DELETE"},
+		{"/admin/users/{userId}/lockout", "DELETE"},
+		{"/admin/users/{userId}/audit-log", "GET"},
+		{"/admin/impersonate/{userId}", "POST"},
+		{"/admin/oauth/clients", "GET"},
+		{"/admin/oauth/clients", "POST"},
+		{"/oauth/authorize", "GET"},
+		{"/oauth/authorize", "POST"},
+		{"/oauth/token", "POST"},
+		{"/oauth/introspect", "POST"},
+		{"/oauth/revoke", "POST"},
 	}
 
 	mux := app.Routes()
@@ -33,6 +81,101 @@ func Test_application_routes(t *testing.T) {
 	}
 }
 
+func Test_application_authorization(t *testing.T) {
+	adminUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+		IsAdmin:   1,
+	}
+
+	regularUser := data.User{
+		ID:        2,
+		FirstName: "Jack",
+		LastName:  "Smith",
+		Email:     "jack@example.com",
+	}
+
+	supportUser := data.User{
+		ID:        5,
+		FirstName: "Sam",
+		LastName:  "Support",
+		Email:     "support@example.com",
+	}
+
+	_ = app.DB.AssignRole(supportUser.ID, "support")
+
+	adminTokens, _ := app.generateTokenPair(&adminUser)
+	userTokens, _ := app.generateTokenPair(&regularUser)
+	supportTokens, _ := app.generateTokenPair(&supportUser)
+
+	var tests = []struct {
+		name            string
+		method          string
+		route           string
+		json            string
+		token           string
+		expectForbidden bool
+	}{
+		{"user deletes user", "DELETE", "/users/1", "", userTokens.AccessToken, true},
+		{"user creates user", "PUT", "/users/", `{"first_name":"Jill","last_name":"Smith","email":"jill@example.com"}`, userTokens.AccessToken, true},
+		{"user patches user", "PATCH", "/users/1", `{"first_name":"Jack"}`, userTokens.AccessToken, true},
+		{"user updates user", "PATCH", "/users/", `{"id":2,"first_name":"Jack","last_name":"Smith","email":"jack@example.com","is_admin":1}`, userTokens.AccessToken, true},
+		{"user gets other user", "GET", "/users/1", "", userTokens.AccessToken, true},
+		{"user gets self", "GET", "/users/2", "", userTokens.AccessToken, false},
+		{"user revokes sessions", "DELETE", "/admin/users/1/sessions", "", userTokens.AccessToken, true},
+		{"user lists users", "GET", "/users/", "", userTokens.AccessToken, true},
+		{"user searches users", "GET", "/users/search?q=smith", "", userTokens.AccessToken, true},
+		{"user assigns role", "POST", "/users/2/roles", `{"role":"admin"}`, userTokens.AccessToken, true},
+		{"user lists OAuth clients", "GET", "/admin/oauth/clients", "", userTokens.AccessToken, true},
+		{"support lists OAuth clients", "GET", "/admin/oauth/clients", "", supportTokens.AccessToken, true},
+		{"admin lists OAuth clients", "GET", "/admin/oauth/clients", "", adminTokens.AccessToken, false},
+		{"support lists users", "GET", "/users/", "", supportTokens.AccessToken, false},
+		{"support searches users", "GET", "/users/search?q=smith", "", supportTokens.AccessToken, false},
+		{"support gets other user", "GET", "/users/1", "", supportTokens.AccessToken, false},
+		{"support deletes user", "DELETE", "/users/1", "", supportTokens.AccessToken, true},
+		{"support lists roles", "GET", "/roles/", "", supportTokens.AccessToken, true},
+		{"admin lists roles", "GET", "/roles/", "", adminTokens.AccessToken, false},
+		{"admin gets other user", "GET", "/users/2", "", adminTokens.AccessToken, false},
+		{"admin deletes user", "DELETE", "/users/2", "", adminTokens.AccessToken, false},
+		{"admin creates user", "PUT", "/users/", `{"first_name":"Jill","last_name":"Smith","email":"jill@example.com"}`, adminTokens.AccessToken, false},
+		{"admin updates user", "PATCH", "/users/", `{"id":1,"first_name":"Admin","last_name":"User","email":"admin@example.com"}`, adminTokens.AccessToken, false},
+		// this test must be the last one, since it revokes the user's tokens
+		{"admin revokes sessions", "DELETE", "/admin/users/2/sessions", "", adminTokens.AccessToken, false},
+	}
+
+	mux := app.Routes()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body io.Reader
+
+			if test.json != "" {
+				body = strings.NewReader(test.json)
+			}
+
+			req, _ := http.NewRequest(test.method, test.route, body)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			if resp.Code == http.StatusUnauthorized {
+				t.Fatalf("%s got status 401; the token should be valid", test.name)
+			}
+
+			if test.expectForbidden && resp.Code != http.StatusForbidden {
+				t.Errorf("%s expected status 403, got %d", test.name, resp.Code)
+			}
+
+			if !test.expectForbidden && resp.Code == http.StatusForbidden {
+				t.Errorf("%s got status 403 but should not have", test.name)
+			}
+		})
+	}
+}
+
 func routeExists(testRoute, testMethod string, chiRoutes chi.Routes) bool {
 	found := false
 
@@ -0,0 +1,110 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxSearchLength = 100
+
+// searchUsers finds users by part of their name or email address, best matches first
+func (app *Application) searchUsers(resp http.ResponseWriter, req *http.Request) {
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+
+	if query == "" {
+		app.errorJSON(resp, errors.New("Search text is required"), http.StatusBadRequest)
+		return
+	}
+
+	if utf8.RuneCountInString(query) > maxSearchLength {
+		app.errorJSON(resp, fmt.Errorf("Search text must be at most %d characters", maxSearchLength), http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := readPage(req.URL.Query())
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	results, total, err := app.DB.SearchUsers(query, limit, (page-1)*limit)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if results == nil {
+		results = []*data.UserSearchResult{}
+	}
+
+	for _, result := range results {
+		result.Highlights = highlightUser(&result.User, query)
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, usersPage[*data.UserSearchResult]{
+		Users: results,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+		Links: app.pageLinks(req, page, limit, total),
+	})
+}
+
+// highlightUser marks where query appears in the user's name and email. Users found despite a
+// typo may have nothing to highlight.
+func highlightUser(user *data.User, query string) map[string]string {
+	match := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+
+	highlights := map[string]string{}
+
+	fields := map[string]string{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"email":      user.Email,
+	}
+
+	for name, value := range fields {
+		if highlighted, ok := highlight(match, value); ok {
+			highlights[name] = highlighted
+		}
+	}
+
+	if len(highlights) == 0 {
+		return nil
+	}
+
+	return highlights
+}
+
+// highlight wraps each match in value in <mark> tags. The rest of value is HTML escaped, so the
+// result is safe to show as HTML.
+func highlight(match *regexp.Regexp, value string) (string, bool) {
+	locations := match.FindAllStringIndex(value, -1)
+
+	if len(locations) == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for _, location := range locations {
+		b.WriteString(html.EscapeString(value[last:location[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(value[location[0]:location[1]]))
+		b.WriteString("</mark>")
+		last = location[1]
+	}
+
+	b.WriteString(html.EscapeString(value[last:]))
+
+	return b.String(), true
+}
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_searchUsers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedIDs        []int
+		expectedTotal      int
+	}{
+		{"last name", "smith", http.StatusOK, []int{2, 3}, 2},
+		{"partial first name", "JI", http.StatusOK, []int{3}, 1},
+		{"email domain", "jones.com", http.StatusOK, []int{4}, 1},
+		{"full name", "jill smith", http.StatusOK, []int{3}, 1},
+		{"first name", "jack", http.StatusOK, []int{2}, 1},
+		{"shorter field ranks higher", "a", http.StatusOK, []int{4, 2, 1}, 3},
+		{"no matches", "nobody", http.StatusOK, []int{}, 0},
+		{"missing query", "", http.StatusBadRequest, nil, 0},
+		{"blank query", "   ", http.StatusBadRequest, nil, 0},
+		{"query too long", strings.Repeat("a", maxSearchLength+1), http.StatusBadRequest, nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/search?q="+url.QueryEscape(test.query), nil)
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.searchUsers).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Fatalf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var page usersPage[*data.UserSearchResult]
+			_ = json.NewDecoder(resp.Body).Decode(&page)
+
+			ids := []int{}
+
+			for _, result := range page.Users {
+				ids = append(ids, result.ID)
+			}
+
+			if fmt.Sprint(ids) != fmt.Sprint(test.expectedIDs) {
+				t.Errorf("%s expected users %v, got %v", test.name, test.expectedIDs, ids)
+			}
+
+			if page.Total != test.expectedTotal {
+				t.Errorf("%s expected total %d, got %d", test.name, test.expectedTotal, page.Total)
+			}
+		})
+	}
+}
+
+func Test_app_searchUsersPages(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/search?q=smith&limit=1", nil)
+	resp := httptest.NewRecorder()
+
+	http.HandlerFunc(app.searchUsers).ServeHTTP(resp, req)
+
+	var page usersPage[*data.UserSearchResult]
+	_ = json.NewDecoder(resp.Body).Decode(&page)
+
+	if len(page.Users) != 1 || page.Total != 2 {
+		t.Fatalf("expected 1 of 2 results, got %d of %d", len(page.Users), page.Total)
+	}
+
+	if page.Links.Next != app.BaseURL+"/users/search?limit=1&page=2&q=smith" || page.Links.Prev != "" {
+		t.Errorf("unexpected links: %+v", page.Links)
+	}
+
+	if page.Users[0].Highlights["last_name"] != "<mark>Smith</mark>" || page.Users[0].Highlights["email"] != "jack@<mark>smith</mark>.com" {
+		t.Errorf("unexpected highlights: %+v", page.Users[0].Highlights)
+	}
+
+	if _, ok := page.Users[0].Highlights["first_name"]; ok {
+		t.Errorf("expected no highlight for a field that doesn't match")
+	}
+}
+
+func Test_highlightUser(t *testing.T) {
+	user := data.User{FirstName: "<b>Ann</b>", LastName: "Annan", Email: "ann@example.com"}
+
+	highlights := highlightUser(&user, "an")
+
+	expected := map[string]string{
+		"first_name": "&lt;b&gt;<mark>An</mark>n&lt;/b&gt;",
+		"last_name":  "<mark>An</mark>n<mark>an</mark>",
+		"email":      "<mark>an</mark>n@example.com",
+	}
+
+	for field, value := range expected {
+		if highlights[field] != value {
+			t.Errorf("expected %s highlighted as %s, got %s", field, value, highlights[field])
+		}
+	}
+
+	if highlightUser(&user, "zzz") != nil {
+		t.Errorf("expected no highlights when nothing matches")
+	}
+}
@@ -0,0 +1,149 @@
+package application
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"strconv"
+)
+
+// startSession issues tokens for a login, starting a new refresh token family, and records the
+// login as a session so the user can see where they are logged in and end it
+func (app *Application) startSession(req *http.Request, user *data.User) (TokenPairs, error) {
+	return app.openSession(user, "", "", req.UserAgent(), clientIP(req))
+}
+
+// startClientSession does the same for tokens issued to an OAuth client, which the user sees as a
+// session named after the client
+func (app *Application) startClientSession(req *http.Request, user *data.User, client *data.OAuthClient, scope string) (TokenPairs, error) {
+	return app.openSession(user, client.ClientID, scope, client.Name, clientIP(req))
+}
+
+func (app *Application) openSession(user *data.User, clientID, scope, userAgent, ipAddress string) (TokenPairs, error) {
+	familyID, err := randomToken(16)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	tokenPair, err := app.issueTokenPair(user, familyID, clientID, scope)
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	_, err = app.DB.InsertSession(data.Session{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	})
+
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	return tokenPair, nil
+}
+
+func (app *Application) mySessions(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	app.writeSessions(resp, req, user.ID)
+}
+
+// endMySession logs the caller out of one of their sessions, e.g. on a lost phone
+func (app *Application) endMySession(resp http.ResponseWriter, req *http.Request) {
+	user, err := app.currentUser(req)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusUnauthorized)
+		return
+	}
+
+	app.endSession(resp, req, user.ID)
+}
+
+func (app *Application) userSessions(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	app.writeSessions(resp, req, userId)
+}
+
+func (app *Application) endUserSession(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	app.endSession(resp, req, userId)
+}
+
+// writeSessions lists a user's active sessions, marking the one the caller's token belongs to
+func (app *Application) writeSessions(resp http.ResponseWriter, req *http.Request, userID int) {
+	sessions, err := app.DB.GetUserSessions(userID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []*data.Session{}
+	}
+
+	if claims, ok := claimsFromContext(req.Context()); ok {
+		for _, session := range sessions {
+			session.Current = claims.SessionID != "" && session.FamilyID == claims.SessionID
+		}
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, sessions)
+}
+
+// endSession ends one of a user's active sessions by revoking its refresh token family, which also
+// invalidates the access tokens issued in it
+func (app *Application) endSession(resp http.ResponseWriter, req *http.Request, userID int) {
+	sessionId, err := strconv.Atoi(chi.URLParam(req, "sessionId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := app.DB.GetUserSessions(userID)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionId {
+			err = app.DB.RevokeRefreshTokenFamily(session.FamilyID)
+
+			if err != nil {
+				app.errorJSON(resp, err, http.StatusInternalServerError)
+				return
+			}
+
+			resp.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	app.errorJSON(resp, errors.New("Session not found"), http.StatusNotFound)
+}
@@ -0,0 +1,131 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_app_sessions(t *testing.T) {
+	sessionApp := app
+	sessionApp.DB = &dbrepo.TestDBRepo{}
+
+	mux := sessionApp.Routes()
+
+	// login logs in from a device, returning its tokens
+	login := func(userAgent, remoteAddr string) TokenPairs {
+		req, _ := http.NewRequest("POST", "/auth", strings.NewReader(`{"email":"admin@example.com","password":"secret"}`))
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = remoteAddr
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		var tokens TokenPairs
+		_ = json.NewDecoder(resp.Body).Decode(&tokens)
+
+		return tokens
+	}
+
+	send := func(method, route, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		mux.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	list := func(route, token string) []data.Session {
+		var sessions []data.Session
+		_ = json.NewDecoder(send("GET", route, token).Body).Decode(&sessions)
+
+		return sessions
+	}
+
+	laptop := login("Firefox", "192.0.2.1:51234")
+	phone := login("Safari on iPhone", "198.51.100.7:443")
+
+	sessions := list("/me/sessions", laptop.AccessToken)
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	for _, session := range sessions {
+		if session.UserAgent == "Firefox" && (session.IPAddress != "192.0.2.1" || !session.Current) {
+			t.Errorf("expected the laptop session to be current and have its IP address, got %+v", session)
+		}
+
+		if session.UserAgent == "Safari on iPhone" && session.Current {
+			t.Errorf("expected the phone session not to be current")
+		}
+	}
+
+	// refreshing tokens counts as using the session, which moves it to the top of the list
+	req, _ := http.NewRequest("GET", "/web/refresh-token", nil)
+	req.AddCookie(&http.Cookie{Name: refreshCookieName, Value: laptop.RefreshToken})
+	resp := httptest.NewRecorder()
+
+	mux.ServeHTTP(resp, req)
+
+	_ = json.NewDecoder(resp.Body).Decode(&laptop)
+
+	sessions = list("/me/sessions", laptop.AccessToken)
+
+	if len(sessions) != 2 || sessions[0].UserAgent != "Firefox" || sessions[0].LastUsedAt.Before(sessions[1].LastUsedAt) {
+		t.Fatalf("expected the refreshed session to still be listed first, got %+v", sessions)
+	}
+
+	var phoneSession data.Session
+
+	for _, session := range sessions {
+		if session.UserAgent == "Safari on iPhone" {
+			phoneSession = session
+		}
+	}
+
+	if resp := send("DELETE", "/me/sessions/999", laptop.AccessToken); resp.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404 ending an unknown session, got %d", resp.Code)
+	}
+
+	if resp := send("DELETE", fmt.Sprintf("/me/sessions/%d", phoneSession.ID), laptop.AccessToken); resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status code 204 ending a session, got %d", resp.Code)
+	}
+
+	if resp := send("GET", "/me", phone.AccessToken); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected the ended session's access token to be rejected, got status code %d", resp.Code)
+	}
+
+	if sessions := list("/me/sessions", laptop.AccessToken); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("expected only the current session to be left, got %+v", sessions)
+	}
+
+	// admins can do the same for any user
+	adminUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1}
+	adminTokens, _ := sessionApp.generateTokenPair(&adminUser)
+
+	sessions = list("/admin/users/1/sessions", adminTokens.AccessToken)
+
+	if len(sessions) != 1 || sessions[0].UserAgent != "Firefox" || sessions[0].Current {
+		t.Fatalf("expected the admin to see the user's laptop session, got %+v", sessions)
+	}
+
+	if resp := send("GET", "/admin/users/1/sessions", laptop.AccessToken); resp.Code != http.StatusForbidden {
+		t.Errorf("expected status code 403 listing sessions without permission, got %d", resp.Code)
+	}
+
+	if resp := send("DELETE", fmt.Sprintf("/admin/users/1/sessions/%d", sessions[0].ID), adminTokens.AccessToken); resp.Code != http.StatusNoContent {
+		t.Errorf("expected status code 204 ending a user's session, got %d", resp.Code)
+	}
+
+	if resp := send("GET", "/me", laptop.AccessToken); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected the laptop to be logged out, got status code %d", resp.Code)
+	}
+}
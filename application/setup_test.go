@@ -2,6 +2,7 @@ package application
 
 import (
 	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"github.com/spartanhooah/testing-rest-api/mailer"
 	"os"
 	"testing"
 )
@@ -12,7 +13,10 @@ var expiredToken = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJhZG1pbiI6dHJ1ZSwiYXV
 func TestMain(m *testing.M) {
 	app.DB = &dbrepo.TestDBRepo{}
 	app.Domain = "example.com"
+	app.BaseURL = "http://localhost:8090"
 	app.JWTSecret = "super-secret"
+	app.Keys = NewKeyring(NewHMACKey(app.JWTSecret))
+	app.Mailer = &mailer.MemoryMailer{}
 
 	os.Exit(m.Run())
 }
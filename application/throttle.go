@@ -0,0 +1,113 @@
+package application
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// failed logins are forgotten after loginFailureWindow without another failure. Once a key reaches
+// its threshold it is locked for loginLockoutBase, doubling with every further failure up to
+// loginLockoutMax.
+var loginFailureWindow = time.Minute * 15
+var loginLockoutBase = time.Minute
+var loginLockoutMax = time.Hour
+
+var errLoginLocked = errors.New("Too many failed login attempts; try again later")
+
+// loginThrottleKeys returns the keys we count failed logins against: the email address that was
+// tried, whether or not it belongs to a user, and the client's IP address
+func loginThrottleKeys(email string, req *http.Request) (string, string) {
+	return "email:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + clientIP(req)
+}
+
+// loginLockedUntil returns when the later of the account and IP lockouts ends, if either applies
+func (app *Application) loginLockedUntil(email string, req *http.Request) (time.Time, bool) {
+	var lockedUntil time.Time
+
+	emailKey, ipKey := loginThrottleKeys(email, req)
+
+	for _, key := range []string{emailKey, ipKey} {
+		failures, err := app.DB.GetLoginFailures(key)
+
+		if err == nil && failures.LockedUntil != nil && failures.LockedUntil.After(lockedUntil) {
+			lockedUntil = *failures.LockedUntil
+		}
+	}
+
+	return lockedUntil, lockedUntil.After(time.Now())
+}
+
+// recordLoginFailure counts a failed login against the account and the IP address, locking
+// whichever has reached its threshold. A threshold of zero turns that check off.
+func (app *Application) recordLoginFailure(email string, req *http.Request) {
+	emailKey, ipKey := loginThrottleKeys(email, req)
+
+	thresholds := map[string]int{
+		emailKey: app.MaxLoginFailures,
+		ipKey:    app.MaxLoginFailuresPerIP,
+	}
+
+	for key, threshold := range thresholds {
+		if threshold <= 0 {
+			continue
+		}
+
+		failures, err := app.DB.RecordLoginFailure(key, loginFailureWindow)
+
+		if err != nil || failures.Failures < threshold {
+			continue
+		}
+
+		lockout := loginLockoutMax
+
+		if excess := failures.Failures - threshold; excess < 16 {
+			lockout = min(loginLockoutBase<<excess, loginLockoutMax)
+		}
+
+		_ = app.DB.LockLogin(key, time.Now().Add(lockout))
+	}
+}
+
+// clearLoginFailures resets the count for an account after a successful login. The IP address
+// count is left alone, so logging in to one account doesn't reset guesses made at others.
+func (app *Application) clearLoginFailures(email string, req *http.Request) {
+	if app.MaxLoginFailures <= 0 {
+		return
+	}
+
+	emailKey, _ := loginThrottleKeys(email, req)
+
+	_ = app.DB.ClearLoginFailures(emailKey)
+}
+
+// unlockUser lets an admin clear a user's lockout before it expires
+func (app *Application) unlockUser(resp http.ResponseWriter, req *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(req, "userId"))
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUser(userId)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	emailKey, _ := loginThrottleKeys(user.Email, req)
+
+	err = app.DB.ClearLoginFailures(emailKey)
+
+	if err != nil {
+		app.errorJSON(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
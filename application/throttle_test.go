@@ -0,0 +1,112 @@
+package application
+
+import (
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_app_loginLockout(t *testing.T) {
+	throttleApp := app
+	throttleApp.MaxLoginFailures = 3
+	throttleApp.MaxLoginFailuresPerIP = 100
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email":"%s","password":"%s"}`, email, password)
+
+		req, _ := http.NewRequest("POST", "/auth", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.10:4321"
+		resp := httptest.NewRecorder()
+
+		http.HandlerFunc(throttleApp.authenticate).ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	var tests = []struct {
+		name               string
+		email              string
+		password           string
+		expectedStatusCode int
+	}{
+		{"first failure", "admin@example.com", "wrong", http.StatusUnauthorized},
+		{"success resets the count", "admin@example.com", "secret", http.StatusOK},
+		{"second failure", "admin@example.com", "wrong", http.StatusUnauthorized},
+		{"third failure", "admin@example.com", "wrong", http.StatusUnauthorized},
+		{"fourth failure locks", "Admin@example.com", "wrong", http.StatusUnauthorized},
+		{"locked with right password", "admin@example.com", "secret", http.StatusTooManyRequests},
+		{"unknown email", "nobody@example.com", "wrong", http.StatusUnauthorized},
+		{"unknown email again", "nobody@example.com", "wrong", http.StatusUnauthorized},
+		{"unknown email locks", "nobody@example.com", "wrong", http.StatusUnauthorized},
+		{"unknown email locked", "nobody@example.com", "wrong", http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := login(test.email, test.password)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+
+			if resp.Code == http.StatusTooManyRequests && resp.Header().Get("Retry-After") == "" {
+				t.Errorf("%s expected a Retry-After header", test.name)
+			}
+		})
+	}
+
+	// an admin can lift the lockout early
+	adminUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+		IsAdmin:   1,
+	}
+
+	tokens, _ := app.generateTokenPair(&adminUser)
+
+	req, _ := http.NewRequest("DELETE", "/admin/users/1/lockout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp := httptest.NewRecorder()
+
+	throttleApp.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status code 204 unlocking user, got %d", resp.Code)
+	}
+
+	if resp := login("admin@example.com", "secret"); resp.Code != http.StatusOK {
+		t.Errorf("expected to log in after unlock, got status code %d", resp.Code)
+	}
+
+	_ = app.DB.ClearLoginFailures("email:nobody@example.com")
+}
+
+func Test_app_loginLockoutPerIP(t *testing.T) {
+	throttleApp := app
+	throttleApp.MaxLoginFailuresPerIP = 2
+
+	login := func(email string) int {
+		req, _ := http.NewRequest("POST", "/auth", strings.NewReader(`{"email":"`+email+`","password":"wrong"}`))
+		req.RemoteAddr = "198.51.100.7:1234"
+		resp := httptest.NewRecorder()
+
+		http.HandlerFunc(throttleApp.authenticate).ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	_ = login("one@example.com")
+	_ = login("two@example.com")
+
+	// the IP address is locked, whichever account it tries next
+	if code := login("three@example.com"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status code 429 once the IP address is locked, got %d", code)
+	}
+
+	_ = app.DB.ClearLoginFailures("ip:198.51.100.7")
+}
@@ -0,0 +1,49 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// every token we issue names what it is for in its typ claim, so that a token issued for one
+// purpose can't be presented for another, e.g. a refresh token as a bearer token
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+// validateToken is the one place we check tokens we issued ourselves. It checks the token is
+// signed by a key in our keyring with that key's algorithm, that we issued it for our own
+// audience, that it is within its exp, nbf and iat times, allowing TokenLeeway for clock skew
+// between our instances, and that its typ is tokenType.
+func (app *Application) validateToken(token, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := app.tokenParser().ParseWithClaims(token, claims, app.keyFunc)
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errors.New("Token is expired")
+		}
+
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("Not a %s token", tokenType)
+	}
+
+	return claims, nil
+}
+
+func (app *Application) tokenParser() *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithValidMethods(app.Keys.Algorithms()),
+		jwt.WithIssuer(app.Domain),
+		jwt.WithAudience(app.Domain),
+		jwt.WithLeeway(app.TokenLeeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+}
@@ -0,0 +1,134 @@
+package application
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_app_validateToken(t *testing.T) {
+	validatorApp := app
+	validatorApp.TokenLeeway = 30 * time.Second
+
+	now := time.Now()
+
+	// claims returns valid access token claims, with the given claims changed; nil removes a claim
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"typ": tokenTypeAccess,
+			"sub": "1",
+			"aud": app.Domain,
+			"iss": app.Domain,
+			"iat": now.Unix(),
+			"nbf": now.Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+		}
+
+		for claim, value := range changes {
+			if value == nil {
+				delete(c, claim)
+			} else {
+				c[claim] = value
+			}
+		}
+
+		return c
+	}
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(method, claims).SignedString(key)
+		return token
+	}
+
+	secret := []byte(app.JWTSecret)
+
+	var tests = []struct {
+		name          string
+		token         string
+		tokenType     string
+		errorExpected bool
+	}{
+		{"valid access token", sign(jwt.SigningMethodHS256, secret, claims(nil)), tokenTypeAccess, false},
+		{"valid refresh token", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"typ": tokenTypeRefresh})), tokenTypeRefresh, false},
+		{"refresh token as access token", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"typ": tokenTypeRefresh})), tokenTypeAccess, true},
+		{"access token as refresh token", sign(jwt.SigningMethodHS256, secret, claims(nil)), tokenTypeRefresh, true},
+		{"untyped token", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"typ": nil})), tokenTypeAccess, true},
+		{"wrong issuer", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"iss": "other.com"})), tokenTypeAccess, true},
+		{"no issuer", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"iss": nil})), tokenTypeAccess, true},
+		{"wrong audience", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"aud": "other.com"})), tokenTypeAccess, true},
+		{"no audience", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"aud": nil})), tokenTypeAccess, true},
+		{"one of several audiences", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"aud": []string{"other.com", app.Domain}})), tokenTypeAccess, false},
+		{"expired", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), tokenTypeAccess, true},
+		{"expired within leeway", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()})), tokenTypeAccess, false},
+		{"no expiry", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"exp": nil})), tokenTypeAccess, true},
+		{"not yet valid", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), tokenTypeAccess, true},
+		{"not yet valid within leeway", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"nbf": now.Add(10 * time.Second).Unix()})), tokenTypeAccess, false},
+		{"issued in the future", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"iat": now.Add(time.Minute).Unix()})), tokenTypeAccess, true},
+		{"issued in the future within leeway", sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"iat": now.Add(10 * time.Second).Unix()})), tokenTypeAccess, false},
+		{"wrong algorithm", sign(jwt.SigningMethodHS384, secret, claims(nil)), tokenTypeAccess, true},
+		{"no signature", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)), tokenTypeAccess, true},
+		{"wrong secret", sign(jwt.SigningMethodHS256, []byte("other-secret"), claims(nil)), tokenTypeAccess, true},
+		{"not a token", "not-a-token", tokenTypeAccess, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validated, err := validatorApp.validateToken(test.token, test.tokenType)
+
+			if err != nil && !test.errorExpected {
+				t.Errorf("%s did not expect error, but got one: %s", test.name, err)
+			}
+
+			if err == nil && test.errorExpected {
+				t.Errorf("%s expected error, but got none", test.name)
+			}
+
+			if err == nil && validated.Subject != "1" {
+				t.Errorf("%s returned the wrong claims: %+v", test.name, validated)
+			}
+		})
+	}
+
+	strictApp := app
+	strictApp.TokenLeeway = 0
+
+	_, err := strictApp.validateToken(sign(jwt.SigningMethodHS256, secret, claims(jwt.MapClaims{"nbf": now.Add(10 * time.Second).Unix()})), tokenTypeAccess)
+
+	if err == nil {
+		t.Errorf("expected a token that isn't valid yet to be rejected without leeway")
+	}
+}
+
+func Test_app_tokenPairTypes(t *testing.T) {
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"}
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	if _, err := app.validateToken(tokens.AccessToken, tokenTypeAccess); err != nil {
+		t.Errorf("access token did not validate: %s", err)
+	}
+
+	if _, err := app.validateToken(tokens.RefreshToken, tokenTypeRefresh); err != nil {
+		t.Errorf("refresh token did not validate: %s", err)
+	}
+
+	// a refresh token must not work as a bearer token
+	if _, err := app.verifyAccessToken(tokens.RefreshToken); err == nil {
+		t.Errorf("refresh token was accepted as an access token")
+	}
+
+	// and an access token must not be exchanged for new tokens
+	req, _ := http.NewRequest("POST", "/refresh-token", strings.NewReader(url.Values{"refresh_token": {tokens.AccessToken}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+
+	http.HandlerFunc(app.refresh).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected status code 400 refreshing with an access token, got %d", resp.Code)
+	}
+}
@@ -1,9 +1,14 @@
 package application
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 )
 
@@ -49,13 +54,22 @@ func (app *Application) errorJSON(w http.ResponseWriter, err error, status ...in
 	}
 
 	type jsonError struct {
-		Message string `json:"message"`
+		Message string           `json:"message"`
+		Fields  validationErrors `json:"fields,omitempty"`
 	}
 
 	theError := jsonError{
 		Message: err.Error(),
 	}
 
+	// invalid input also gets the list of fields, for clients to show next to each one
+	var invalid validationErrors
+
+	if errors.As(err, &invalid) {
+		theError.Message = "Invalid input"
+		theError.Fields = invalid
+	}
+
 	_ = app.writeJSON(w, statusCode, theError, "error")
 }
 
@@ -79,3 +93,33 @@ func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, data an
 
 	return nil
 }
+
+// randomToken returns a URL-safe string built from n random bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of a token; this is what we store in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP returns the IP address a request came from
+func clientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return ip
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxFieldLength    = 255
+	minPasswordLength = 8
+
+	// bcrypt ignores anything after the first 72 bytes of a password
+	maxPasswordBytes = 72
+)
+
+// fieldError says why the value of one field in a request is invalid
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationErrors lists every invalid field in a request, so a client can point them all out at
+// once. errorJSON includes them in the response; send them with 422 Unprocessable Entity.
+type validationErrors []fieldError
+
+func (v *validationErrors) add(field, message string) {
+	*v = append(*v, fieldError{Field: field, Message: message})
+}
+
+// only keeps the errors for the given fields
+func (v validationErrors) only(fields ...string) validationErrors {
+	var kept validationErrors
+
+	for _, e := range v {
+		for _, field := range fields {
+			if e.Field == field {
+				kept = append(kept, e)
+			}
+		}
+	}
+
+	return kept
+}
+
+func (v validationErrors) Error() string {
+	messages := make([]string, len(v))
+
+	for i, e := range v {
+		messages[i] = e.Field + " " + e.Message
+	}
+
+	return "Invalid input: " + strings.Join(messages, "; ")
+}
+
+// validateUser checks the fields of a user that clients can set
+func validateUser(user *data.User) validationErrors {
+	var errs validationErrors
+
+	validateName(&errs, "first_name", user.FirstName)
+	validateName(&errs, "last_name", user.LastName)
+	validateEmail(&errs, "email", user.Email)
+
+	if user.IsAdmin != 0 && user.IsAdmin != 1 {
+		errs.add("is_admin", "must be 0 or 1")
+	}
+
+	return errs
+}
+
+// validateCredentials checks a login request is well formed. It doesn't apply the password policy,
+// which may have changed since the user chose their password.
+func validateCredentials(creds Credentials) validationErrors {
+	var errs validationErrors
+
+	validateEmail(&errs, "email", creds.Username)
+
+	if creds.Password == "" {
+		errs.add("password", "is required")
+	}
+
+	return errs
+}
+
+func validateName(errs *validationErrors, field, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		errs.add(field, "is required")
+	case utf8.RuneCountInString(name) > maxFieldLength:
+		errs.add(field, fmt.Sprintf("must be at most %d characters", maxFieldLength))
+	}
+}
+
+func validateEmail(errs *validationErrors, field, email string) {
+	switch {
+	case email == "":
+		errs.add(field, "is required")
+	case len(email) > maxFieldLength:
+		errs.add(field, fmt.Sprintf("must be at most %d characters", maxFieldLength))
+	case !isEmailAddress(email):
+		errs.add(field, "must be a valid email address")
+	}
+}
+
+// isEmailAddress reports whether email is a bare address, like jack@example.com, with no display
+// name or angle brackets
+func isEmailAddress(email string) bool {
+	address, err := mail.ParseAddress(email)
+
+	return err == nil && address.Address == email
+}
+
+// validatePassword applies our password policy to a new password
+func validatePassword(errs *validationErrors, field, password string) {
+	switch {
+	case password == "":
+		errs.add(field, "is required")
+	case utf8.RuneCountInString(password) < minPasswordLength:
+		errs.add(field, fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	case len(password) > maxPasswordBytes:
+		errs.add(field, fmt.Sprintf("must be at most %d bytes", maxPasswordBytes))
+	case strings.TrimSpace(password) == "":
+		errs.add(field, "must not be only spaces")
+	}
+}
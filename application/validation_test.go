@@ -0,0 +1,156 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validationResponse struct {
+	Error struct {
+		Message string       `json:"message"`
+		Fields  []fieldError `json:"fields"`
+	} `json:"error"`
+}
+
+func Test_validateUser(t *testing.T) {
+	var tests = []struct {
+		name           string
+		user           data.User
+		expectedFields []string
+	}{
+		{"valid", data.User{FirstName: "Jack", LastName: "Smith", Email: "jack@example.com"}, nil},
+		{"valid admin", data.User{FirstName: "Jack", LastName: "Smith", Email: "jack@example.com", IsAdmin: 1}, nil},
+		{"empty", data.User{}, []string{"first_name", "last_name", "email"}},
+		{"blank names", data.User{FirstName: "  ", LastName: "\t", Email: "jack@example.com"}, []string{"first_name", "last_name"}},
+		{"long name", data.User{FirstName: strings.Repeat("a", maxFieldLength+1), LastName: "Smith", Email: "jack@example.com"}, []string{"first_name"}},
+		{"long name in characters, not bytes", data.User{FirstName: strings.Repeat("é", maxFieldLength), LastName: "Smith", Email: "jack@example.com"}, nil},
+		{"no domain", data.User{FirstName: "Jack", LastName: "Smith", Email: "jack"}, []string{"email"}},
+		{"display name", data.User{FirstName: "Jack", LastName: "Smith", Email: "Jack <jack@example.com>"}, []string{"email"}},
+		{"bad is_admin", data.User{FirstName: "Jack", LastName: "Smith", Email: "jack@example.com", IsAdmin: 2}, []string{"is_admin"}},
+	}
+
+	for _, test := range tests {
+		var fields []string
+
+		for _, e := range validateUser(&test.user) {
+			fields = append(fields, e.Field)
+		}
+
+		if fmt.Sprint(fields) != fmt.Sprint(test.expectedFields) {
+			t.Errorf("%s: expected errors for %v, got %v", test.name, test.expectedFields, fields)
+		}
+	}
+}
+
+func Test_validatePassword(t *testing.T) {
+	var tests = []struct {
+		name            string
+		password        string
+		expectedMessage string
+	}{
+		{"valid", "a good password", ""},
+		{"empty", "", "is required"},
+		{"too short", "seven77", "must be at least 8 characters"},
+		{"too long for bcrypt", strings.Repeat("a", maxPasswordBytes+1), "must be at most 72 bytes"},
+		{"only spaces", "          ", "must not be only spaces"},
+	}
+
+	for _, test := range tests {
+		var errs validationErrors
+		validatePassword(&errs, "password", test.password)
+
+		message := ""
+
+		if len(errs) > 0 {
+			message = errs[0].Message
+		}
+
+		if message != test.expectedMessage {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expectedMessage, message)
+		}
+	}
+}
+
+func Test_app_createUserValidation(t *testing.T) {
+	var tests = []struct {
+		name           string
+		json           string
+		expectedFields map[string]string
+	}{
+		{
+			"nothing",
+			`{}`,
+			map[string]string{
+				"first_name": "is required",
+				"last_name":  "is required",
+				"email":      "is required",
+				"password":   "is required",
+			},
+		},
+		{
+			"bad email and short password",
+			`{"first_name":"Jack","last_name":"Smith","email":"jack","password":"short"}`,
+			map[string]string{
+				"email":    "must be a valid email address",
+				"password": "must be at least 8 characters",
+			},
+		},
+		{
+			"email in use",
+			`{"first_name":"Jack","last_name":"Smith","email":"admin@example.com","password":"a good password"}`,
+			map[string]string{
+				"email": "is already in use",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/users/", strings.NewReader(test.json))
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.createUser).ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("%s expected status code 422, got %d", test.name, resp.Code)
+			}
+
+			var body validationResponse
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+
+			fields := map[string]string{}
+
+			for _, e := range body.Error.Fields {
+				fields[e.Field] = e.Message
+			}
+
+			if fmt.Sprint(fields) != fmt.Sprint(test.expectedFields) {
+				t.Errorf("%s expected %v, got %v", test.name, test.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func Test_app_authenticateValidation(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/auth", strings.NewReader(`{"email":"not an email","password":""}`))
+	resp := httptest.NewRecorder()
+
+	http.HandlerFunc(app.authenticate).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status code 422, got %d", resp.Code)
+	}
+
+	var body validationResponse
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+
+	if body.Error.Message != "Invalid input" || len(body.Error.Fields) != 2 ||
+		body.Error.Fields[0].Field != "email" || body.Error.Fields[1].Field != "password" {
+		t.Errorf("unexpected error: %+v", body.Error)
+	}
+}
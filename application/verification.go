@@ -0,0 +1,84 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const tokenTypeEmailVerification = "email-verification"
+
+var emailVerificationExpiry = time.Hour * 24
+
+// sendVerificationEmail emails a signed link which proves the user owns their email address.
+// The link names the address, so it stops working if the address changes before it is followed.
+func (app *Application) sendVerificationEmail(user *data.User) error {
+	claims := jwt.MapClaims{}
+	claims["typ"] = tokenTypeEmailVerification
+	claims["sub"] = fmt.Sprint(user.ID)
+	claims["email"] = user.Email
+	claims["aud"] = app.Domain
+	claims["iss"] = app.Domain
+	claims["exp"] = time.Now().Add(emailVerificationExpiry).Unix()
+
+	token, err := app.signToken(claims)
+
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", app.BaseURL, url.QueryEscape(token))
+
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by following this link within %s:\n\n%s\n",
+			user.FirstName, emailVerificationExpiry, link),
+	})
+}
+
+// sendVerificationEmailIfChanged sends a verification email when a user is new or their address
+// has changed. Failing to send doesn't fail the request; the user can be sent another link later.
+func (app *Application) sendVerificationEmailIfChanged(previous, user *data.User) {
+	if previous != nil && previous.Email == user.Email {
+		return
+	}
+
+	err := app.sendVerificationEmail(user)
+
+	if err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+}
+
+func (app *Application) verifyEmail(resp http.ResponseWriter, req *http.Request) {
+	claims, err := app.validateToken(req.URL.Query().Get("token"), tokenTypeEmailVerification)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Invalid or expired token"), http.StatusBadRequest)
+		return
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("Invalid or expired token"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.DB.MarkEmailVerified(userId, claims.Email)
+
+	if err != nil {
+		app.errorJSON(resp, errors.New("This link is for an email address which is no longer on the account"), http.StatusBadRequest)
+		return
+	}
+
+	_ = app.writeJSON(resp, http.StatusOK, map[string]string{"message": "Email address verified"})
+}
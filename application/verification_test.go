@@ -0,0 +1,122 @@
+package application
+
+import (
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/mailer"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_verificationEmailSent(t *testing.T) {
+	var tests = []struct {
+		name        string
+		method      string
+		json        string
+		handler     http.HandlerFunc
+		expectEmail string
+	}{
+		{"create user", "PUT", `{"first_name":"Jill","last_name":"Smith","email":"jill@example.com","password":"a good password"}`, app.createUser, "jill@example.com"},
+		{"change email", "PATCH", `{"id":1,"first_name":"Admin","last_name":"User","email":"admin2@example.com"}`, app.updateUser, "admin2@example.com"},
+		{"keep email", "PATCH", `{"id":1,"first_name":"Admin","last_name":"User","email":"admin@example.com"}`, app.updateUser, ""},
+	}
+
+	sentMail := app.Mailer.(*mailer.MemoryMailer)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sentBefore := len(sentMail.Messages())
+
+			req, _ := http.NewRequest(test.method, "/", strings.NewReader(test.json))
+			resp := httptest.NewRecorder()
+
+			test.handler.ServeHTTP(resp, req)
+
+			messages := sentMail.Messages()[sentBefore:]
+
+			if test.expectEmail == "" && len(messages) > 0 {
+				t.Errorf("%s should not have sent an email, but sent one to %s", test.name, messages[0].To)
+			}
+
+			if test.expectEmail != "" && (len(messages) != 1 || messages[0].To != test.expectEmail) {
+				t.Errorf("%s expected a verification email to %s, got %v", test.name, test.expectEmail, messages)
+			}
+		})
+	}
+}
+
+func Test_app_verifyEmail(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	// the admin user is not verified yet, so can't log in while verification is required
+	verifyingApp := app
+	verifyingApp.RequireVerifiedEmail = true
+
+	login := func() int {
+		req, _ := http.NewRequest("POST", "/auth", strings.NewReader(`{"email":"admin@example.com","password":"secret"}`))
+		resp := httptest.NewRecorder()
+
+		http.HandlerFunc(verifyingApp.authenticate).ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	if code := login(); code != http.StatusForbidden {
+		t.Errorf("unverified login expected status code %d, got %d", http.StatusForbidden, code)
+	}
+
+	oldAddress := testUser
+	oldAddress.Email = "old@example.com"
+	_ = app.sendVerificationEmail(&oldAddress)
+	oldAddressToken := linkToken(t, "old@example.com")
+
+	_ = app.sendVerificationEmail(&testUser)
+	token := linkToken(t, "admin@example.com")
+
+	accessTokens, _ := app.generateTokenPair(&testUser)
+
+	var tests = []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+	}{
+		{"no token", "", http.StatusBadRequest},
+		{"access token", accessTokens.AccessToken, http.StatusBadRequest},
+		{"address no longer on account", oldAddressToken, http.StatusBadRequest},
+		{"valid token", token, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/verify-email?token="+url.QueryEscape(test.token), nil)
+			resp := httptest.NewRecorder()
+
+			http.HandlerFunc(app.verifyEmail).ServeHTTP(resp, req)
+
+			if test.expectedStatusCode != resp.Code {
+				t.Errorf("%s expected status code %d, got %d", test.name, test.expectedStatusCode, resp.Code)
+			}
+		})
+	}
+
+	// a verification token must not work as an access token
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	_, _, err := app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), req)
+
+	if err == nil {
+		t.Errorf("verification token was accepted as an access token")
+	}
+
+	if code := login(); code != http.StatusOK {
+		t.Errorf("verified login expected status code %d, got %d", http.StatusOK, code)
+	}
+}
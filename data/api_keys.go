@@ -0,0 +1,18 @@
+package data
+
+import "time"
+
+// APIKey is the type for a long-lived key a user creates for scripts and other automation. Only a
+// hash of the key is stored; the Prefix, the first few characters of the key, is kept so users can
+// tell their keys apart. A key with Scopes only grants those of the user's permissions.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package data
+
+import "time"
+
+// AuditEvent is the type for an entry in the audit log: something ActorID did as, or to, UserID.
+// Action is what they did, e.g. the method and path of a request, and Status is the HTTP status
+// it got.
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	ActorID   int       `json:"actor_id"`
+	UserID    int       `json:"user_id"`
+	Action    string    `json:"action"`
+	Status    int       `json:"status"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package data
+
+import "time"
+
+// LoginFailures counts recent failed logins for one key; either an email address or an IP address.
+type LoginFailures struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// MFA is the type for a user's TOTP second factor. Until ConfirmedAt is set the user has started
+// enrolling but hasn't shown their authenticator app works, so logins don't ask for a code yet.
+// LastUsedStep is the TOTP time step of the last code accepted, so a code can't be replayed.
+type MFA struct {
+	UserID       int        `json:"user_id"`
+	Secret       string     `json:"-"`
+	LastUsedStep int64      `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package data
+
+import "time"
+
+// OAuthClient is the type for an application registered to send users through our OAuth2
+// authorization endpoint. Users can only be sent back to one of its RedirectURIs, and it can only
+// ask for the Scopes it was registered with. Confidential clients, such as backend services, also
+// have a secret, of which only a hash is stored; public clients like SPAs and mobile apps don't.
+type OAuthClient struct {
+	ID           int       `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	SecretHash   string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Confidential reports whether the client has a secret to authenticate with
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AuthorizationCode is the type for a single-use code handed to a client through its redirect URI,
+// which the client exchanges for tokens. Only a hash of the code is stored, along with the PKCE
+// challenge the client must answer when it exchanges the code, and the OpenID Connect nonce to
+// put in the ID token.
+type AuthorizationCode struct {
+	ID                  int        `json:"id"`
+	CodeHash            string     `json:"-"`
+	ClientID            string     `json:"client_id"`
+	UserID              int        `json:"user_id"`
+	RedirectURI         string     `json:"redirect_uri"`
+	Scope               string     `json:"scope"`
+	CodeChallenge       string     `json:"-"`
+	CodeChallengeMethod string     `json:"-"`
+	Nonce               string     `json:"-"`
+	ExpiresAt           time.Time  `json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at,omitempty"`
+	CreatedAt           time.Time  `json:"-"`
+}
+
+// OAuthConsent records the scopes a user has agreed to let a client have, so they aren't asked
+// again each time the client sends them to log in.
+type OAuthConsent struct {
+	UserID    int       `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+}
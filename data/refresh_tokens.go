@@ -0,0 +1,19 @@
+package data
+
+import "time"
+
+// RefreshToken is the type for a refresh token we have issued. Only a hash of the token
+// is stored; every token rotated out of the same login shares a FamilyID. Tokens issued to an OAuth
+// client carry its ClientID and the Scope the user granted it, so they stay bound to both.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	ClientID  string     `json:"client_id,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"-"`
+}
@@ -0,0 +1,13 @@
+package data
+
+import "time"
+
+// Role is the type for a named set of permissions which can be assigned to users.
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+}
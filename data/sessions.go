@@ -0,0 +1,16 @@
+package data
+
+import "time"
+
+// Session is the type for a login, recording where it came from. It is linked to the refresh
+// token family the login started, so ending the session revokes its tokens.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	FamilyID   string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,15 @@
+package data
+
+import "time"
+
+// UserToken is the type for a single-use token we email to a user, such as a password reset
+// link. Only a hash of the token is stored, and Purpose says what the token may be used for.
+type UserToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"-"`
+}
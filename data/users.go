@@ -8,15 +8,26 @@ import (
 
 // User describes the data for the User type.
 type User struct {
-	ID             int       `json:"id"`
-	FirstName      string    `json:"first_name"`
-	LastName       string    `json:"last_name"`
-	Email          string    `json:"email"`
-	Password       string    `json:"-"`
-	IsAdmin        int       `json:"is_admin"`
-	CreatedAt      time.Time `json:"-"`
-	UpdatedAt      time.Time `json:"-"`
-	ProfilePicture UserImage `json:"-"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	IsAdmin         int        `json:"is_admin"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"-"`
+	UpdatedAt       time.Time  `json:"-"`
+	Version         int        `json:"-"`
+	ProfilePicture  UserImage  `json:"-"`
+}
+
+// UserSearchResult is a user found by a search, with how well they matched. Highlights holds the
+// fields containing the search text, HTML escaped, with each match wrapped in <mark> tags.
+type UserSearchResult struct {
+	User
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights,omitempty"`
 }
 
 // PasswordMatches uses Go's bcrypt package to compare a user supplied password
@@ -0,0 +1,143 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"strings"
+	"time"
+)
+
+// scopes are stored space separated in a single column, as they are for OAuth clients
+const apiKeyQuery = `
+	select id, user_id, name, prefix, key_hash, scope, expires_at, last_used_at, created_at
+	from api_keys`
+
+// GetUserAPIKeys returns a user's API keys, newest first
+func (m *PostgresDBRepo) GetUserAPIKeys(userID int) ([]*data.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, apiKeyQuery+`
+	where user_id = $1
+	order by created_at desc, id desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*data.APIKey
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetAPIKey returns the API key with the given hash. If there is no such key, sql.ErrNoRows is
+// returned.
+func (m *PostgresDBRepo) GetAPIKey(keyHash string) (*data.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, apiKeyQuery+`
+	where key_hash = $1`, keyHash)
+
+	return scanAPIKey(row)
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*data.APIKey, error) {
+	var key data.APIKey
+	var scope string
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scope,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scope)
+
+	return &key, nil
+}
+
+// InsertAPIKey stores a hashed API key, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertAPIKey(k data.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into api_keys (user_id, name, prefix, key_hash, scope, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		k.UserID,
+		k.Name,
+		k.Prefix,
+		k.KeyHash,
+		strings.Join(k.Scopes, " "),
+		k.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// MarkAPIKeyUsed records when an API key was last used
+func (m *PostgresDBRepo) MarkAPIKeyUsed(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update api_keys set last_used_at = $1 where id = $2`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), id)
+
+	return err
+}
+
+// DeleteAPIKey revokes one of a user's API keys. If the user has no key with that ID,
+// sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) DeleteAPIKey(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from api_keys where id = $1 and user_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// GetUserAPIKeys returns a user's API keys, newest first
+func (m *TestDBRepo) GetUserAPIKeys(userID int) ([]*data.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []*data.APIKey
+
+	for i := len(m.apiKeys) - 1; i >= 0; i-- {
+		if m.apiKeys[i].UserID == userID {
+			key := *m.apiKeys[i]
+			keys = append(keys, &key)
+		}
+	}
+
+	return keys, nil
+}
+
+// GetAPIKey returns the API key with the given hash
+func (m *TestDBRepo) GetAPIKey(keyHash string) (*data.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.apiKeys {
+		if k.KeyHash == keyHash {
+			key := *k
+			return &key, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// InsertAPIKey stores a hashed API key, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertAPIKey(k data.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apiKeyID++
+	k.ID = m.apiKeyID
+	k.CreatedAt = time.Now()
+	m.apiKeys = append(m.apiKeys, &k)
+
+	return k.ID, nil
+}
+
+// MarkAPIKeyUsed records when an API key was last used
+func (m *TestDBRepo) MarkAPIKeyUsed(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.apiKeys {
+		if k.ID == id {
+			now := time.Now()
+			k.LastUsedAt = &now
+		}
+	}
+
+	return nil
+}
+
+// DeleteAPIKey revokes one of a user's API keys
+func (m *TestDBRepo) DeleteAPIKey(userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, k := range m.apiKeys {
+		if k.ID == id && k.UserID == userID {
+			m.apiKeys = append(m.apiKeys[:i], m.apiKeys[i+1:]...)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
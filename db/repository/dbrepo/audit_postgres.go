@@ -0,0 +1,74 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// InsertAuditEvent writes an entry to the audit log, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertAuditEvent(e data.AuditEvent) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into audit_log (actor_id, user_id, action, status, ip_address, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		e.ActorID,
+		e.UserID,
+		e.Action,
+		e.Status,
+		e.IPAddress,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetUserAuditEvents returns the audit log entries about a user, newest first
+func (m *PostgresDBRepo) GetUserAuditEvents(userID int) ([]*data.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select id, actor_id, user_id, action, status, ip_address, created_at
+		from audit_log
+		where user_id = $1
+		order by created_at desc, id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*data.AuditEvent
+
+	for rows.Next() {
+		var e data.AuditEvent
+
+		err := rows.Scan(
+			&e.ID,
+			&e.ActorID,
+			&e.UserID,
+			&e.Action,
+			&e.Status,
+			&e.IPAddress,
+			&e.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,35 @@
+package dbrepo
+
+import (
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// InsertAuditEvent writes an entry to the audit log, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertAuditEvent(e data.AuditEvent) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = len(m.auditLog) + 1
+	e.CreatedAt = time.Now()
+	m.auditLog = append(m.auditLog, &e)
+
+	return e.ID, nil
+}
+
+// GetUserAuditEvents returns the audit log entries about a user, newest first
+func (m *TestDBRepo) GetUserAuditEvents(userID int) ([]*data.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []*data.AuditEvent
+
+	for i := len(m.auditLog) - 1; i >= 0; i-- {
+		if m.auditLog[i].UserID == userID {
+			event := *m.auditLog[i]
+			events = append(events, &event)
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,95 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// GetLoginFailures returns the failed login count for a key. A key with no failures is not an
+// error; it has a count of zero.
+func (m *PostgresDBRepo) GetLoginFailures(key string) (*data.LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select key, failures, last_failure_at, locked_until from login_failures where key = $1`
+
+	f := data.LoginFailures{Key: key}
+
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(
+		&f.Key,
+		&f.Failures,
+		&f.LastFailureAt,
+		&f.LockedUntil,
+	)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// RecordLoginFailure adds one to the failed login count for a key. If the last failure was longer
+// ago than window, counting starts again from one.
+func (m *PostgresDBRepo) RecordLoginFailure(key string, window time.Duration) (*data.LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	stmt := `
+		insert into login_failures (key, failures, last_failure_at)
+			values ($1, 1, $2)
+		on conflict (key) do update set
+			failures = case when login_failures.last_failure_at < $3 then 1 else login_failures.failures + 1 end,
+			last_failure_at = $2
+		returning key, failures, last_failure_at, locked_until`
+
+	var f data.LoginFailures
+
+	err := m.DB.QueryRowContext(ctx, stmt, key, now, now.Add(-window)).Scan(
+		&f.Key,
+		&f.Failures,
+		&f.LastFailureAt,
+		&f.LockedUntil,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// LockLogin stops logins for a key until the given time
+func (m *PostgresDBRepo) LockLogin(key string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update login_failures set locked_until = $1 where key = $2`
+
+	_, err := m.DB.ExecContext(ctx, stmt, until, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClearLoginFailures forgets the failed logins for a key, unlocking it
+func (m *PostgresDBRepo) ClearLoginFailures(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from login_failures where key = $1`
+
+	_, err := m.DB.ExecContext(ctx, stmt, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package dbrepo
+
+import (
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// GetLoginFailures returns the failed login count for a key
+func (m *TestDBRepo) GetLoginFailures(key string) (*data.LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.loginFailures[key]; ok {
+		found := *f
+		return &found, nil
+	}
+
+	return &data.LoginFailures{Key: key}, nil
+}
+
+// RecordLoginFailure adds one to the failed login count for a key
+func (m *TestDBRepo) RecordLoginFailure(key string, window time.Duration) (*data.LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.loginFailures == nil {
+		m.loginFailures = make(map[string]*data.LoginFailures)
+	}
+
+	now := time.Now()
+	f, ok := m.loginFailures[key]
+
+	if !ok {
+		f = &data.LoginFailures{Key: key}
+		m.loginFailures[key] = f
+	}
+
+	if f.LastFailureAt.Before(now.Add(-window)) {
+		f.Failures = 0
+	}
+
+	f.Failures++
+	f.LastFailureAt = now
+
+	found := *f
+
+	return &found, nil
+}
+
+// LockLogin stops logins for a key until the given time
+func (m *TestDBRepo) LockLogin(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.loginFailures[key]; ok {
+		f.LockedUntil = &until
+	}
+
+	return nil
+}
+
+// ClearLoginFailures forgets the failed logins for a key, unlocking it
+func (m *TestDBRepo) ClearLoginFailures(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginFailures, key)
+
+	return nil
+}
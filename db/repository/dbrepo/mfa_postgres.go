@@ -0,0 +1,185 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"time"
+)
+
+// GetMFA returns a user's second factor. A user who hasn't enrolled is not an error; the returned
+// MFA has an empty Secret.
+func (m *PostgresDBRepo) GetMFA(userID int) (*data.MFA, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select user_id, secret, last_used_step, confirmed_at, created_at from user_mfa where user_id = $1`
+
+	mfa := data.MFA{UserID: userID}
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.LastUsedStep,
+		&mfa.ConfirmedAt,
+		&mfa.CreatedAt,
+	)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SetMFASecret starts enrolling a user with a new, unconfirmed secret, replacing any earlier one
+func (m *PostgresDBRepo) SetMFASecret(userID int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		insert into user_mfa (user_id, secret, last_used_step, confirmed_at, created_at)
+			values ($1, $2, 0, null, $3)
+		on conflict (user_id) do update set
+			secret = excluded.secret,
+			last_used_step = 0,
+			confirmed_at = null,
+			created_at = excluded.created_at`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, secret, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmMFA turns on a user's second factor, recording the time step of the code they confirmed
+// with and replacing their recovery codes
+func (m *PostgresDBRepo) ConfirmMFA(userID int, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt := `update user_mfa set confirmed_at = $1, last_used_step = $2 where user_id = $3`
+
+	result, err := tx.ExecContext(ctx, stmt, time.Now(), step, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseMFAStep records that a code from the given time step has been used. If a code from this or a
+// later step has already been used, repository.ErrMFACodeUsed is returned.
+func (m *PostgresDBRepo) UseMFAStep(userID int, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update user_mfa set last_used_step = $1 where user_id = $2 and last_used_step < $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, step, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return repository.ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes throws away a user's recovery codes, used or not, and stores new ones
+func (m *PostgresDBRepo) ReplaceRecoveryCodes(userID int, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, recoveryCodeHashes []string) error {
+	_, err := tx.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into mfa_recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)`
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, stmt, userID, codeHash, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks one of a user's unused recovery codes as used. If there is no such code,
+// sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) UseRecoveryCode(userID int, codeHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update mfa_recovery_codes set used_at = $1 where user_id = $2 and code_hash = $3 and used_at is null`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteMFA turns off a user's second factor and deletes their recovery codes
+func (m *PostgresDBRepo) DeleteMFA(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `delete from user_mfa where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
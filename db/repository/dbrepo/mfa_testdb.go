@@ -0,0 +1,117 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"time"
+)
+
+// GetMFA returns a user's second factor, with an empty Secret if they haven't enrolled
+func (m *TestDBRepo) GetMFA(userID int) (*data.MFA, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mfa, ok := m.mfa[userID]; ok {
+		found := *mfa
+		return &found, nil
+	}
+
+	return &data.MFA{UserID: userID}, nil
+}
+
+// SetMFASecret starts enrolling a user with a new, unconfirmed secret
+func (m *TestDBRepo) SetMFASecret(userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mfa == nil {
+		m.mfa = make(map[int]*data.MFA)
+	}
+
+	m.mfa[userID] = &data.MFA{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+
+	return nil
+}
+
+// ConfirmMFA turns on a user's second factor and replaces their recovery codes
+func (m *TestDBRepo) ConfirmMFA(userID int, step int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	mfa, ok := m.mfa[userID]
+
+	if ok {
+		now := time.Now()
+		mfa.ConfirmedAt = &now
+		mfa.LastUsedStep = step
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	return m.ReplaceRecoveryCodes(userID, recoveryCodeHashes)
+}
+
+// UseMFAStep records that a code from the given time step has been used
+func (m *TestDBRepo) UseMFAStep(userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+
+	if !ok || mfa.LastUsedStep >= step {
+		return repository.ErrMFACodeUsed
+	}
+
+	mfa.LastUsedStep = step
+
+	return nil
+}
+
+// ReplaceRecoveryCodes throws away a user's recovery codes and stores new ones
+func (m *TestDBRepo) ReplaceRecoveryCodes(userID int, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.recoveryCodes == nil {
+		m.recoveryCodes = make(map[int]map[string]bool)
+	}
+
+	codes := make(map[string]bool)
+
+	for _, codeHash := range recoveryCodeHashes {
+		codes[codeHash] = false
+	}
+
+	m.recoveryCodes[userID] = codes
+
+	return nil
+}
+
+// UseRecoveryCode marks one of a user's unused recovery codes as used
+func (m *TestDBRepo) UseRecoveryCode(userID int, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+
+	if !ok || used {
+		return sql.ErrNoRows
+	}
+
+	m.recoveryCodes[userID][codeHash] = true
+
+	return nil
+}
+
+// DeleteMFA turns off a user's second factor and deletes their recovery codes
+func (m *TestDBRepo) DeleteMFA(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mfa, userID)
+	delete(m.recoveryCodes, userID)
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"strings"
+	"time"
+)
+
+// redirect URIs and scopes are each stored space separated in a single column; neither can
+// contain spaces
+const oauthClientQuery = `
+	select id, client_id, name, redirect_uris, scope, coalesce(secret_hash, ''), created_at
+	from oauth_clients`
+
+// AllOAuthClients returns all registered OAuth clients as a slice of *data.OAuthClient
+func (m *PostgresDBRepo) AllOAuthClients() ([]*data.OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, oauthClientQuery+`
+	order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*data.OAuthClient
+
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// GetOAuthClient returns one OAuth client by its client ID
+func (m *PostgresDBRepo) GetOAuthClient(clientID string) (*data.OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, oauthClientQuery+`
+	where client_id = $1`, clientID)
+
+	return scanOAuthClient(row)
+}
+
+func scanOAuthClient(row interface{ Scan(dest ...any) error }) (*data.OAuthClient, error) {
+	var client data.OAuthClient
+	var redirectURIs, scope string
+
+	err := row.Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.Name,
+		&redirectURIs,
+		&scope,
+		&client.SecretHash,
+		&client.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.Scopes = strings.Fields(scope)
+
+	return &client, nil
+}
+
+// InsertOAuthClient registers an OAuth client, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertOAuthClient(c data.OAuthClient) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into oauth_clients (client_id, name, redirect_uris, scope, secret_hash, created_at)
+		values ($1, $2, $3, $4, nullif($5, ''), $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		c.ClientID,
+		c.Name,
+		strings.Join(c.RedirectURIs, " "),
+		strings.Join(c.Scopes, " "),
+		c.SecretHash,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// InsertAuthorizationCode stores a hashed authorization code, and returns the ID of the newly
+// inserted row
+func (m *PostgresDBRepo) InsertAuthorizationCode(c data.AuthorizationCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope,
+			code_challenge, code_challenge_method, nonce, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		c.CodeHash,
+		c.ClientID,
+		c.UserID,
+		c.RedirectURI,
+		c.Scope,
+		c.CodeChallenge,
+		c.CodeChallengeMethod,
+		c.Nonce,
+		c.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// ConsumeAuthorizationCode marks an unused, unexpired authorization code as used and returns it.
+// If there is no such code, sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) ConsumeAuthorizationCode(codeHash string) (*data.AuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		update oauth_authorization_codes set used_at = $1
+		where
+			code_hash = $2 and used_at is null and expires_at > $1
+		returning id, code_hash, client_id, user_id, redirect_uri, scope, code_challenge,
+			code_challenge_method, nonce, expires_at, used_at, created_at`
+
+	var c data.AuthorizationCode
+
+	err := m.DB.QueryRowContext(ctx, stmt, time.Now(), codeHash).Scan(
+		&c.ID,
+		&c.CodeHash,
+		&c.ClientID,
+		&c.UserID,
+		&c.RedirectURI,
+		&c.Scope,
+		&c.CodeChallenge,
+		&c.CodeChallengeMethod,
+		&c.Nonce,
+		&c.ExpiresAt,
+		&c.UsedAt,
+		&c.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetOAuthConsent returns the scopes a user has agreed to give a client. If they haven't been
+// asked yet, sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) GetOAuthConsent(userID int, clientID string) (*data.OAuthConsent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select user_id, client_id, scope, created_at from oauth_consents where user_id = $1 and client_id = $2`
+
+	var c data.OAuthConsent
+
+	err := m.DB.QueryRowContext(ctx, query, userID, clientID).Scan(
+		&c.UserID,
+		&c.ClientID,
+		&c.Scope,
+		&c.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// SaveOAuthConsent records the scopes a user has agreed to give a client, replacing any earlier
+// consent
+func (m *PostgresDBRepo) SaveOAuthConsent(c data.OAuthConsent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		insert into oauth_consents (user_id, client_id, scope, created_at)
+			values ($1, $2, $3, $4)
+		on conflict (user_id, client_id) do update set
+			scope = excluded.scope,
+			created_at = excluded.created_at`
+
+	_, err := m.DB.ExecContext(ctx, stmt, c.UserID, c.ClientID, c.Scope, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// AllOAuthClients returns all registered OAuth clients as a slice of *data.OAuthClient
+func (m *TestDBRepo) AllOAuthClients() ([]*data.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var clients []*data.OAuthClient
+
+	for _, c := range m.oauthClients {
+		client := *c
+		clients = append(clients, &client)
+	}
+
+	return clients, nil
+}
+
+// GetOAuthClient returns one OAuth client by its client ID
+func (m *TestDBRepo) GetOAuthClient(clientID string) (*data.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.oauthClients {
+		if c.ClientID == clientID {
+			client := *c
+			return &client, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// InsertOAuthClient registers an OAuth client, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertOAuthClient(c data.OAuthClient) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.oauthClients {
+		if existing.ClientID == c.ClientID {
+			return 0, errors.New("client ID already registered")
+		}
+	}
+
+	c.ID = len(m.oauthClients) + 1
+	c.CreatedAt = time.Now()
+	m.oauthClients = append(m.oauthClients, &c)
+
+	return c.ID, nil
+}
+
+// InsertAuthorizationCode stores a hashed authorization code, and returns the ID of the newly
+// inserted row
+func (m *TestDBRepo) InsertAuthorizationCode(c data.AuthorizationCode) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.ID = len(m.authCodes) + 1
+	c.CreatedAt = time.Now()
+	m.authCodes = append(m.authCodes, &c)
+
+	return c.ID, nil
+}
+
+// ConsumeAuthorizationCode marks an unused, unexpired authorization code as used and returns it
+func (m *TestDBRepo) ConsumeAuthorizationCode(codeHash string) (*data.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, c := range m.authCodes {
+		if c.CodeHash == codeHash && c.UsedAt == nil && c.ExpiresAt.After(now) {
+			c.UsedAt = &now
+			found := *c
+
+			return &found, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// GetOAuthConsent returns the scopes a user has agreed to give a client
+func (m *TestDBRepo) GetOAuthConsent(userID int, clientID string) (*data.OAuthConsent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.oauthConsents {
+		if c.UserID == userID && c.ClientID == clientID {
+			found := *c
+			return &found, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// SaveOAuthConsent records the scopes a user has agreed to give a client
+func (m *TestDBRepo) SaveOAuthConsent(c data.OAuthConsent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.CreatedAt = time.Now()
+
+	for i, existing := range m.oauthConsents {
+		if existing.UserID == c.UserID && existing.ClientID == c.ClientID {
+			m.oauthConsents[i] = &c
+			return nil
+		}
+	}
+
+	m.oauthConsents = append(m.oauthConsents, &c)
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"time"
+)
+
+// InsertRefreshToken stores a hashed refresh token, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertRefreshToken(t data.RefreshToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into refresh_tokens (user_id, family_id, client_id, scope, token_hash, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		t.UserID,
+		t.FamilyID,
+		t.ClientID,
+		t.Scope,
+		t.TokenHash,
+		t.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetRefreshToken returns one refresh token by the hash of its value
+func (m *PostgresDBRepo) GetRefreshToken(tokenHash string) (*data.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select
+			id, user_id, family_id, client_id, scope, token_hash, expires_at, used_at, revoked_at, created_at
+		from
+			refresh_tokens
+		where
+			token_hash = $1`
+
+	var t data.RefreshToken
+	row := m.DB.QueryRowContext(ctx, query, tokenHash)
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.FamilyID,
+		&t.ClientID,
+		&t.Scope,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.RevokedAt,
+		&t.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// MarkRefreshTokenUsed records that a refresh token has been exchanged. It returns
+// repository.ErrRefreshTokenUsed if the token was already used, so that two concurrent
+// refreshes with the same token can't both succeed.
+func (m *PostgresDBRepo) MarkRefreshTokenUsed(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set used_at = $1 where id = $2 and used_at is null`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return repository.ErrRefreshTokenUsed
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token descended from the same login
+func (m *PostgresDBRepo) RevokeRefreshTokenFamily(familyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where family_id = $2 and revoked_at is null`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token belonging to a user, ending all of their sessions
+func (m *PostgresDBRepo) RevokeUserRefreshTokens(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
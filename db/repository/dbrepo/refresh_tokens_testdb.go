@@ -0,0 +1,88 @@
+package dbrepo
+
+import (
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"time"
+)
+
+// InsertRefreshToken stores a hashed refresh token, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertRefreshToken(t data.RefreshToken) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = len(m.refreshTokens) + 1
+	t.CreatedAt = time.Now()
+	m.refreshTokens = append(m.refreshTokens, &t)
+
+	return t.ID, nil
+}
+
+// GetRefreshToken returns one refresh token by the hash of its value
+func (m *TestDBRepo) GetRefreshToken(tokenHash string) (*data.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.TokenHash == tokenHash {
+			found := *t
+			return &found, nil
+		}
+	}
+
+	return nil, errors.New("refresh token not found")
+}
+
+// MarkRefreshTokenUsed records that a refresh token has been exchanged
+func (m *TestDBRepo) MarkRefreshTokenUsed(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.ID == id {
+			if t.UsedAt != nil {
+				return repository.ErrRefreshTokenUsed
+			}
+
+			now := time.Now()
+			t.UsedAt = &now
+
+			return nil
+		}
+	}
+
+	return errors.New("refresh token not found")
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token descended from the same login
+func (m *TestDBRepo) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token belonging to a user, ending all of their sessions
+func (m *TestDBRepo) RevokeUserRefreshTokens(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
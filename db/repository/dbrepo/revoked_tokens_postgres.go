@@ -0,0 +1,44 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+)
+
+// RevokeAccessToken adds an access token's ID to the denylist. The row is only needed until
+// the token would have expired anyway.
+func (m *PostgresDBRepo) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into revoked_tokens (jti, expires_at, created_at)
+		values ($1, $2, $3) on conflict (jti) do nothing`
+
+	_, err := m.DB.ExecContext(ctx, stmt, jti, expiresAt, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token is on the denylist, or was issued as part of
+// a refresh token family that has since been revoked
+func (m *PostgresDBRepo) IsAccessTokenRevoked(jti, familyID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select
+			exists(select 1 from revoked_tokens where jti = $1)
+			or exists(select 1 from refresh_tokens where family_id = $2 and revoked_at is not null)`
+
+	var revoked bool
+
+	err := m.DB.QueryRowContext(ctx, query, jti, familyID).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
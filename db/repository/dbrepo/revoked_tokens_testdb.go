@@ -0,0 +1,36 @@
+package dbrepo
+
+import "time"
+
+// RevokeAccessToken adds an access token's ID to the denylist
+func (m *TestDBRepo) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.revokedTokens == nil {
+		m.revokedTokens = make(map[string]time.Time)
+	}
+
+	m.revokedTokens[jti] = expiresAt
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token is on the denylist, or was issued as part of
+// a refresh token family that has since been revoked
+func (m *TestDBRepo) IsAccessTokenRevoked(jti, familyID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.revokedTokens[jti]; ok {
+		return true, nil
+	}
+
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,177 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"strings"
+	"time"
+)
+
+// roleQuery selects roles along with a comma separated list of their permissions
+const roleQuery = `
+	select
+		r.id, r.name, r.description, r.created_at, r.updated_at,
+		coalesce(string_agg(p.name, ',' order by p.name), '')
+	from
+		roles r
+		left join role_permissions rp on rp.role_id = r.id
+		left join permissions p on p.id = rp.permission_id`
+
+// AllRoles returns all roles, with their permissions, as a slice of *data.Role
+func (m *PostgresDBRepo) AllRoles() ([]*data.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := roleQuery + `
+	group by r.id
+	order by r.name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRoles(rows)
+}
+
+// GetRole returns one role, with its permissions, by name
+func (m *PostgresDBRepo) GetRole(name string) (*data.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := roleQuery + `
+	where r.name = $1
+	group by r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles, err := scanRoles(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return roles[0], nil
+}
+
+// GetUserRoles returns the roles assigned to a user, with their permissions
+func (m *PostgresDBRepo) GetUserRoles(userID int) ([]*data.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := roleQuery + `
+	where r.id in (select role_id from user_roles where user_id = $1)
+	group by r.id
+	order by r.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRoles(rows)
+}
+
+// AssignRole gives a user a role. Assigning the admin role also sets the legacy is_admin column.
+func (m *PostgresDBRepo) AssignRole(userID int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var roleID int
+
+	err = tx.QueryRowContext(ctx, `select id from roles where name = $1`, role).Scan(&roleID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into user_roles (user_id, role_id, created_at)
+		values ($1, $2, $3) on conflict do nothing`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, roleID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if role == "admin" {
+		_, err = tx.ExecContext(ctx, `update users set is_admin = 1, updated_at = $1, version = version + 1 where id = $2`, time.Now(), userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveRole takes a role away from a user. Removing the admin role also clears the legacy is_admin column.
+func (m *PostgresDBRepo) RemoveRole(userID int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `delete from user_roles where user_id = $1 and role_id = (select id from roles where name = $2)`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, role)
+	if err != nil {
+		return err
+	}
+
+	if role == "admin" {
+		_, err = tx.ExecContext(ctx, `update users set is_admin = 0, updated_at = $1, version = version + 1 where id = $2`, time.Now(), userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanRoles(rows *sql.Rows) ([]*data.Role, error) {
+	var roles []*data.Role
+
+	for rows.Next() {
+		var role data.Role
+		var permissions string
+
+		err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+			&permissions,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		role.Permissions = []string{}
+		if permissions != "" {
+			role.Permissions = strings.Split(permissions, ",")
+		}
+
+		roles = append(roles, &role)
+	}
+
+	return roles, rows.Err()
+}
@@ -0,0 +1,106 @@
+package dbrepo
+
+import (
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"slices"
+)
+
+// testRoles mirrors the roles seeded in testdata/users.sql
+var testRoles = []data.Role{
+	{
+		ID:          1,
+		Name:        "admin",
+		Description: "Full access",
+		Permissions: []string{"clients:manage", "roles:manage", "sessions:revoke", "users:delete", "users:impersonate", "users:read", "users:write"},
+	},
+	{
+		ID:          2,
+		Name:        "support",
+		Description: "Support staff; can look users up",
+		Permissions: []string{"users:read"},
+	},
+}
+
+// AllRoles returns all roles, with their permissions, as a slice of *data.Role
+func (m *TestDBRepo) AllRoles() ([]*data.Role, error) {
+	var roles []*data.Role
+
+	for _, role := range testRoles {
+		r := role
+		roles = append(roles, &r)
+	}
+
+	return roles, nil
+}
+
+// GetRole returns one role, with its permissions, by name
+func (m *TestDBRepo) GetRole(name string) (*data.Role, error) {
+	for _, role := range testRoles {
+		if role.Name == name {
+			r := role
+			return &r, nil
+		}
+	}
+
+	return nil, errors.New("role not found")
+}
+
+// GetUserRoles returns the roles assigned to a user, with their permissions
+func (m *TestDBRepo) GetUserRoles(userID int) ([]*data.Role, error) {
+	m.mu.Lock()
+	names := slices.Clone(m.userRoles[userID])
+	m.mu.Unlock()
+
+	var roles []*data.Role
+
+	for _, name := range names {
+		role, _ := m.GetRole(name)
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// AssignRole gives a user a role
+func (m *TestDBRepo) AssignRole(userID int, role string) error {
+	if _, err := m.GetRole(role); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userRoles == nil {
+		m.userRoles = make(map[int][]string)
+	}
+
+	if !slices.Contains(m.userRoles[userID], role) {
+		m.userRoles[userID] = append(m.userRoles[userID], role)
+	}
+
+	// the admin role is mirrored in is_admin, so it changes the user
+	if role == "admin" {
+		m.bumpUserVersion(userID)
+	}
+
+	return nil
+}
+
+// RemoveRole takes a role away from a user
+func (m *TestDBRepo) RemoveRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userRoles == nil {
+		m.userRoles = make(map[int][]string)
+	}
+
+	m.userRoles[userID] = slices.DeleteFunc(m.userRoles[userID], func(r string) bool { return r == role })
+
+	if role == "admin" {
+		m.bumpUserVersion(userID)
+	}
+
+	return nil
+}
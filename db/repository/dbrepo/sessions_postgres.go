@@ -0,0 +1,93 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// InsertSession records a login, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertSession(s data.Session) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	var newID int
+	stmt := `insert into sessions (user_id, family_id, user_agent, ip_address, created_at, last_used_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		s.UserID,
+		s.FamilyID,
+		s.UserAgent,
+		s.IPAddress,
+		now,
+		now,
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetUserSessions returns a user's active sessions, most recently used first. A session is active
+// while its refresh token family has a token which can still be exchanged; logging out, revoking
+// the family or letting the last token expire all end it.
+func (m *PostgresDBRepo) GetUserSessions(userID int) ([]*data.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select s.id, s.user_id, s.family_id, s.user_agent, s.ip_address, s.created_at, s.last_used_at
+		from sessions s
+		where s.user_id = $1 and exists (
+			select 1 from refresh_tokens rt
+			where rt.family_id = s.family_id and rt.used_at is null and rt.revoked_at is null and rt.expires_at > $2
+		)
+		order by s.last_used_at desc, s.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*data.Session
+
+	for rows.Next() {
+		var s data.Session
+
+		err := rows.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.FamilyID,
+			&s.UserAgent,
+			&s.IPAddress,
+			&s.CreatedAt,
+			&s.LastUsedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// MarkSessionUsed records that the session started by a refresh token family was just used
+func (m *PostgresDBRepo) MarkSessionUsed(familyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update sessions set last_used_at = $1 where family_id = $2`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), familyID)
+
+	return err
+}
@@ -0,0 +1,67 @@
+package dbrepo
+
+import (
+	"github.com/spartanhooah/testing-rest-api/data"
+	"sort"
+	"time"
+)
+
+// InsertSession records a login, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertSession(s data.Session) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.ID = len(m.sessions) + 1
+	s.CreatedAt = time.Now()
+	s.LastUsedAt = s.CreatedAt
+	m.sessions = append(m.sessions, &s)
+
+	return s.ID, nil
+}
+
+// GetUserSessions returns a user's active sessions, most recently used first
+func (m *TestDBRepo) GetUserSessions(userID int) ([]*data.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	active := func(familyID string) bool {
+		for _, t := range m.refreshTokens {
+			if t.FamilyID == familyID && t.UsedAt == nil && t.RevokedAt == nil && t.ExpiresAt.After(now) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var sessions []*data.Session
+
+	for _, s := range m.sessions {
+		if s.UserID == userID && active(s.FamilyID) {
+			session := *s
+			sessions = append(sessions, &session)
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// MarkSessionUsed records that the session started by a refresh token family was just used
+func (m *TestDBRepo) MarkSessionUsed(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.FamilyID == familyID {
+			s.LastUsedAt = time.Now()
+		}
+	}
+
+	return nil
+}
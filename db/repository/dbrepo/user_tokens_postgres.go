@@ -0,0 +1,63 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// InsertUserToken stores a hashed single-use token, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertUserToken(t data.UserToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		t.UserID,
+		t.Purpose,
+		t.TokenHash,
+		t.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it. Checking and using the
+// token happen in one statement, so a token can't be redeemed twice. If there is no such token,
+// sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) ConsumeUserToken(tokenHash, purpose string) (*data.UserToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		update user_tokens set used_at = $1
+		where
+			token_hash = $2 and purpose = $3 and used_at is null and expires_at > $1
+		returning id, user_id, purpose, token_hash, expires_at, used_at, created_at`
+
+	var t data.UserToken
+
+	err := m.DB.QueryRowContext(ctx, stmt, time.Now(), tokenHash, purpose).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Purpose,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,38 @@
+package dbrepo
+
+import (
+	"errors"
+	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
+)
+
+// InsertUserToken stores a hashed single-use token, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertUserToken(t data.UserToken) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = len(m.userTokens) + 1
+	t.CreatedAt = time.Now()
+	m.userTokens = append(m.userTokens, &t)
+
+	return t.ID, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it
+func (m *TestDBRepo) ConsumeUserToken(tokenHash, purpose string) (*data.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, t := range m.userTokens {
+		if t.TokenHash == tokenHash && t.Purpose == purpose && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			t.UsedAt = &now
+			found := *t
+
+			return &found, nil
+		}
+	}
+
+	return nil, errors.New("token not found")
+}
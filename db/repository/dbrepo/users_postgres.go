@@ -3,9 +3,13 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -24,7 +28,8 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, is_admin, created_at, updated_at
+	query := `select id, email, first_name, last_name, password, is_admin, email_verified, email_verified_at,
+		created_at, updated_at
 	from users order by last_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
@@ -44,6 +49,8 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.IsAdmin,
+			&user.EmailVerified,
+			&user.EmailVerifiedAt,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -58,6 +65,168 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+// ListUsers returns one page of the users matching opts, along with how many users match in all
+func (m *PostgresDBRepo) ListUsers(opts repository.UserListOptions) ([]*data.User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	sort := opts.Sort
+
+	if sort == "" {
+		sort = "last_name"
+	}
+
+	// sort is written into the query, so it must be one of ours
+	if !slices.Contains(repository.UserSortColumns, sort) {
+		return nil, 0, fmt.Errorf("cannot sort users by %s", sort)
+	}
+
+	direction := "asc"
+
+	if opts.Descending {
+		direction = "desc"
+	}
+
+	var conditions []string
+	var args []any
+
+	if opts.Email != "" {
+		args = append(args, opts.Email)
+		conditions = append(conditions, fmt.Sprintf("lower(email) = lower($%d)", len(args)))
+	}
+
+	if opts.IsAdmin != nil {
+		if *opts.IsAdmin {
+			conditions = append(conditions, "is_admin = 1")
+		} else {
+			conditions = append(conditions, "coalesce(is_admin, 0) <> 1")
+		}
+	}
+
+	if opts.CreatedAfter != nil {
+		args = append(args, *opts.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at > $%d", len(args)))
+	}
+
+	where := ""
+
+	if len(conditions) > 0 {
+		where = "where " + strings.Join(conditions, " and ")
+	}
+
+	var total int
+
+	err := m.DB.QueryRowContext(ctx, "select count(*) from users "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`select id, email, first_name, last_name, password, is_admin, email_verified, email_verified_at,
+		created_at, updated_at
+	from users %s
+	order by %s %s, id %s
+	limit $%d offset $%d`, where, sort, direction, direction, len(args)+1, len(args)+2)
+
+	// limit null means no limit
+	var limit any
+
+	if opts.Limit > 0 {
+		limit = opts.Limit
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, append(args, limit, opts.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*data.User
+
+	for rows.Next() {
+		var user data.User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.IsAdmin,
+			&user.EmailVerified,
+			&user.EmailVerifiedAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SearchUsers finds users whose name or email contains query, or is close to it, using the
+// trigram index on users.search. Results are ranked by word similarity, best first.
+func (m *PostgresDBRepo) SearchUsers(query string, limit, offset int) ([]*data.UserSearchResult, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// the query is matched as a substring, so it mustn't be read as a LIKE pattern
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	var total int
+
+	err := m.DB.QueryRowContext(ctx,
+		`select count(*) from users where search ilike $2 or $1 <% search`,
+		query, pattern,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `select id, email, first_name, last_name, password, is_admin, email_verified, email_verified_at,
+		created_at, updated_at, word_similarity($1, search) as rank
+	from users
+	where search ilike $2 or $1 <% search
+	order by rank desc, last_name, id
+	limit $3 offset $4`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, query, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []*data.UserSearchResult
+
+	for rows.Next() {
+		var result data.UserSearchResult
+		err := rows.Scan(
+			&result.ID,
+			&result.Email,
+			&result.FirstName,
+			&result.LastName,
+			&result.Password,
+			&result.IsAdmin,
+			&result.EmailVerified,
+			&result.EmailVerifiedAt,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		results = append(results, &result)
+	}
+
+	return results, total, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // GetUser returns one user by id
 func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
@@ -65,8 +234,8 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 
 	query := `
 		select
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
-			coalesce(ui.file_name, '')
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.email_verified, u.email_verified_at,
+			u.created_at, u.updated_at, u.version, coalesce(ui.file_name, '')
 		from
 			users u
 			left join user_images ui on u.id = ui.user_id
@@ -83,8 +252,11 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.EmailVerified,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 		&user.ProfilePicture.FileName,
 	)
 
@@ -102,8 +274,8 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 
 	query := `
 		select
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
-			coalesce(ui.file_name, '')
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.email_verified, u.email_verified_at,
+			u.created_at, u.updated_at, u.version, coalesce(ui.file_name, '')
 		from
 			users u
 			left join user_images ui on u.id = ui.user_id
@@ -120,8 +292,11 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.EmailVerified,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 		&user.ProfilePicture.FileName,
 	)
 
@@ -132,34 +307,44 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 	return &user, nil
 }
 
-// UpdateUser updates one user in the database
+// UpdateUser updates one user in the database. Changing the email address clears the verified flag.
+// If u.Version is set, the update only happens if the user is still at that version, and otherwise
+// returns a *repository.VersionConflictError. Every update adds one to the version.
 func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `update users set
+		email_verified = email_verified and email = $1,
+		email_verified_at = case when email = $1 then email_verified_at end,
 		email = $1,
 		first_name = $2,
 		last_name = $3,
 		is_admin = $4,
-		updated_at = $5
-		where id = $6
+		updated_at = $5,
+		version = version + 1
+		where id = $6 and ($7 = 0 or version = $7)
 	`
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	result, err := m.DB.ExecContext(ctx, stmt,
 		u.Email,
 		u.FirstName,
 		u.LastName,
 		u.IsAdmin,
 		time.Now(),
 		u.ID,
+		u.Version,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if u.Version == 0 {
+		return nil
+	}
+
+	return m.checkVersion(ctx, result, u.ID, u.Version)
 }
 
 // DeleteUser deletes one user from the database, by id
@@ -177,6 +362,43 @@ func (m *PostgresDBRepo) DeleteUser(id int) error {
 	return nil
 }
 
+// DeleteUserAtVersion deletes one user from the database, by id, if they are still at version.
+// Otherwise it returns a *repository.VersionConflictError, or sql.ErrNoRows if they don't exist.
+func (m *PostgresDBRepo) DeleteUserAtVersion(id, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from users where id = $1 and version = $2`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, version)
+	if err != nil {
+		return err
+	}
+
+	return m.checkVersion(ctx, result, id, version)
+}
+
+// checkVersion works out why a statement conditional on a user's version changed nothing
+func (m *PostgresDBRepo) checkVersion(ctx context.Context, result sql.Result, id, version int) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows > 0 {
+		return nil
+	}
+
+	var current int
+
+	err = m.DB.QueryRowContext(ctx, `select version from users where id = $1`, id).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	return &repository.VersionConflictError{ID: id, Version: version, CurrentVersion: current}
+}
+
 // InsertUser inserts a new user into the database, and returns the ID of the newly inserted row
 func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
@@ -257,3 +479,29 @@ func (m *PostgresDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 
 	return newID, nil
 }
+
+// MarkEmailVerified records that a user has proven they own their email address. If the user's
+// address is no longer the one that was verified, nothing changes and sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) MarkEmailVerified(id int, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set email_verified = true, email_verified_at = $1, version = version + 1
+		where id = $2 and email = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id, email)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ package dbrepo
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v5"
@@ -15,6 +16,7 @@ import (
 	"github.com/spartanhooah/profile-picture-web/db/repository"
 	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -292,3 +294,673 @@ func Test_PostgresDBRepo_InsertUserImage(t *testing.T) {
 		t.Errorf("Should not have been able attach image to nonexistent user")
 	}
 }
+
+func Test_PostgresDBRepo_RefreshTokens(t *testing.T) {
+	token := data.RefreshToken{
+		UserID:    1,
+		FamilyID:  "family",
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	id, err := testRepo.InsertRefreshToken(token)
+
+	if err != nil {
+		t.Errorf("Error inserting refresh token: %s", err)
+	}
+
+	stored, err := testRepo.GetRefreshToken("hash")
+
+	if err != nil {
+		t.Errorf("Error getting refresh token: %s", err)
+	}
+
+	if stored.ID != id || stored.FamilyID != "family" {
+		t.Errorf("Incorrect refresh token returned: %v", stored)
+	}
+
+	err = testRepo.MarkRefreshTokenUsed(id)
+
+	if err != nil {
+		t.Errorf("Error marking refresh token used: %s", err)
+	}
+
+	err = testRepo.MarkRefreshTokenUsed(id)
+
+	if !errors.Is(err, repository.ErrRefreshTokenUsed) {
+		t.Errorf("Expected ErrRefreshTokenUsed marking token used twice, got %v", err)
+	}
+
+	err = testRepo.RevokeRefreshTokenFamily("family")
+
+	if err != nil {
+		t.Errorf("Error revoking refresh token family: %s", err)
+	}
+
+	stored, _ = testRepo.GetRefreshToken("hash")
+
+	if stored.RevokedAt == nil {
+		t.Errorf("Refresh token should have been revoked")
+	}
+}
+
+func Test_PostgresDBRepo_Roles(t *testing.T) {
+	roles, err := testRepo.AllRoles()
+
+	if err != nil {
+		t.Errorf("Error getting all roles: %s", err)
+	}
+
+	if len(roles) != 2 {
+		t.Errorf("Incorrect number of roles returned; expected 2 but got %d", len(roles))
+	}
+
+	err = testRepo.AssignRole(1, "support")
+
+	if err != nil {
+		t.Errorf("Error assigning role: %s", err)
+	}
+
+	roles, _ = testRepo.GetUserRoles(1)
+
+	if len(roles) != 1 || roles[0].Name != "support" || len(roles[0].Permissions) != 1 {
+		t.Errorf("Expected user 1 to have the support role with one permission, got %v", roles)
+	}
+
+	err = testRepo.AssignRole(1, "superuser")
+
+	if err == nil {
+		t.Errorf("Should not have been able to assign a nonexistent role")
+	}
+
+	err = testRepo.RemoveRole(1, "support")
+
+	if err != nil {
+		t.Errorf("Error removing role: %s", err)
+	}
+
+	roles, _ = testRepo.GetUserRoles(1)
+
+	if len(roles) != 0 {
+		t.Errorf("Expected user 1 to have no roles, got %d", len(roles))
+	}
+}
+
+func Test_PostgresDBRepo_UserTokens(t *testing.T) {
+	_, err := testRepo.InsertUserToken(data.UserToken{
+		UserID:    1,
+		Purpose:   "password-reset",
+		TokenHash: "reset-hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting user token: %s", err)
+	}
+
+	_, err = testRepo.ConsumeUserToken("reset-hash", "magic-link")
+
+	if err == nil {
+		t.Errorf("Should not have been able to use a token for a different purpose")
+	}
+
+	token, err := testRepo.ConsumeUserToken("reset-hash", "password-reset")
+
+	if err != nil {
+		t.Errorf("Error consuming user token: %s", err)
+	}
+
+	if token.UserID != 1 || token.UsedAt == nil {
+		t.Errorf("Incorrect user token returned: %v", token)
+	}
+
+	_, err = testRepo.ConsumeUserToken("reset-hash", "password-reset")
+
+	if err == nil {
+		t.Errorf("Should not have been able to use a token twice")
+	}
+}
+
+func Test_PostgresDBRepo_MarkEmailVerified(t *testing.T) {
+	err := testRepo.MarkEmailVerified(1, "someone-else@example.com")
+
+	if err == nil {
+		t.Errorf("Should not have been able to verify an address the user doesn't have")
+	}
+
+	err = testRepo.MarkEmailVerified(1, "admin@example.com")
+
+	if err != nil {
+		t.Errorf("Error verifying email: %s", err)
+	}
+
+	user, _ := testRepo.GetUser(1)
+
+	if !user.EmailVerified || user.EmailVerifiedAt == nil {
+		t.Errorf("Expected user 1 to be verified")
+	}
+
+	user.Email = "new-admin@example.com"
+	_ = testRepo.UpdateUser(*user)
+
+	user, _ = testRepo.GetUser(1)
+
+	if user.EmailVerified || user.EmailVerifiedAt != nil {
+		t.Errorf("Changing the email address should have cleared the verified flag")
+	}
+
+	user.Email = "admin@example.com"
+	_ = testRepo.UpdateUser(*user)
+}
+
+func Test_PostgresDBRepo_LoginFailures(t *testing.T) {
+	failures, err := testRepo.GetLoginFailures("email:admin@example.com")
+
+	if err != nil {
+		t.Errorf("Error getting login failures: %s", err)
+	}
+
+	if failures.Failures != 0 || failures.LockedUntil != nil {
+		t.Errorf("Expected no failures, got %v", failures)
+	}
+
+	_, _ = testRepo.RecordLoginFailure("email:admin@example.com", time.Minute)
+	failures, err = testRepo.RecordLoginFailure("email:admin@example.com", time.Minute)
+
+	if err != nil {
+		t.Errorf("Error recording login failure: %s", err)
+	}
+
+	if failures.Failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", failures.Failures)
+	}
+
+	err = testRepo.LockLogin("email:admin@example.com", time.Now().Add(time.Minute))
+
+	if err != nil {
+		t.Errorf("Error locking login: %s", err)
+	}
+
+	failures, _ = testRepo.GetLoginFailures("email:admin@example.com")
+
+	if failures.LockedUntil == nil {
+		t.Errorf("Expected login to be locked")
+	}
+
+	err = testRepo.ClearLoginFailures("email:admin@example.com")
+
+	if err != nil {
+		t.Errorf("Error clearing login failures: %s", err)
+	}
+
+	failures, _ = testRepo.GetLoginFailures("email:admin@example.com")
+
+	if failures.Failures != 0 || failures.LockedUntil != nil {
+		t.Errorf("Expected failures to be cleared, got %v", failures)
+	}
+}
+
+func Test_PostgresDBRepo_MFA(t *testing.T) {
+	mfa, err := testRepo.GetMFA(1)
+
+	if err != nil {
+		t.Errorf("Error getting MFA: %s", err)
+	}
+
+	if mfa.Secret != "" {
+		t.Errorf("Expected user 1 not to be enrolled")
+	}
+
+	err = testRepo.ConfirmMFA(1, 1, nil)
+
+	if err == nil {
+		t.Errorf("Should not have been able to confirm MFA before enrolling")
+	}
+
+	err = testRepo.SetMFASecret(1, "JBSWY3DPEHPK3PXP")
+
+	if err != nil {
+		t.Errorf("Error setting MFA secret: %s", err)
+	}
+
+	err = testRepo.ConfirmMFA(1, 100, []string{"code-hash-1", "code-hash-2"})
+
+	if err != nil {
+		t.Errorf("Error confirming MFA: %s", err)
+	}
+
+	mfa, _ = testRepo.GetMFA(1)
+
+	if mfa.ConfirmedAt == nil || mfa.LastUsedStep != 100 {
+		t.Errorf("Incorrect MFA returned: %v", mfa)
+	}
+
+	if err := testRepo.UseMFAStep(1, 100); !errors.Is(err, repository.ErrMFACodeUsed) {
+		t.Errorf("Expected ErrMFACodeUsed reusing a time step, got %v", err)
+	}
+
+	if err := testRepo.UseMFAStep(1, 101); err != nil {
+		t.Errorf("Error using a new time step: %s", err)
+	}
+
+	if err := testRepo.UseRecoveryCode(1, "code-hash-1"); err != nil {
+		t.Errorf("Error using recovery code: %s", err)
+	}
+
+	if err := testRepo.UseRecoveryCode(1, "code-hash-1"); err == nil {
+		t.Errorf("Should not have been able to use a recovery code twice")
+	}
+
+	_ = testRepo.ReplaceRecoveryCodes(1, []string{"code-hash-3"})
+
+	if err := testRepo.UseRecoveryCode(1, "code-hash-2"); err == nil {
+		t.Errorf("Should not have been able to use a replaced recovery code")
+	}
+
+	err = testRepo.DeleteMFA(1)
+
+	if err != nil {
+		t.Errorf("Error deleting MFA: %s", err)
+	}
+
+	mfa, _ = testRepo.GetMFA(1)
+
+	if mfa.Secret != "" {
+		t.Errorf("Expected MFA to be deleted")
+	}
+}
+
+func Test_PostgresDBRepo_OAuth(t *testing.T) {
+	_, err := testRepo.InsertOAuthClient(data.OAuthClient{
+		ClientID:     "test-client",
+		Name:         "Test Client",
+		RedirectURIs: []string{"https://app.example.com/callback", "http://127.0.0.1:9000/callback"},
+		Scopes:       []string{"openid", "profile"},
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting OAuth client: %s", err)
+	}
+
+	client, err := testRepo.GetOAuthClient("test-client")
+
+	if err != nil {
+		t.Errorf("Error getting OAuth client: %s", err)
+	}
+
+	if client.Name != "Test Client" || len(client.RedirectURIs) != 2 || len(client.Scopes) != 2 {
+		t.Errorf("Incorrect OAuth client returned: %v", client)
+	}
+
+	clients, _ := testRepo.AllOAuthClients()
+
+	if len(clients) != 1 {
+		t.Errorf("Expected 1 OAuth client, got %d", len(clients))
+	}
+
+	_, err = testRepo.InsertAuthorizationCode(data.AuthorizationCode{
+		CodeHash:            "code-hash",
+		ClientID:            "test-client",
+		UserID:              1,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+		Nonce:               "n-0S6_WzA2Mj",
+		ExpiresAt:           time.Now().Add(time.Minute),
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting authorization code: %s", err)
+	}
+
+	code, err := testRepo.ConsumeAuthorizationCode("code-hash")
+
+	if err != nil {
+		t.Errorf("Error consuming authorization code: %s", err)
+	}
+
+	if code.UserID != 1 || code.Scope != "openid" || code.Nonce != "n-0S6_WzA2Mj" || code.UsedAt == nil {
+		t.Errorf("Incorrect authorization code returned: %v", code)
+	}
+
+	_, err = testRepo.ConsumeAuthorizationCode("code-hash")
+
+	if err == nil {
+		t.Errorf("Should not have been able to use an authorization code twice")
+	}
+
+	_, err = testRepo.GetOAuthConsent(1, "test-client")
+
+	if err == nil {
+		t.Errorf("Expected no consent before it was given")
+	}
+
+	_ = testRepo.SaveOAuthConsent(data.OAuthConsent{UserID: 1, ClientID: "test-client", Scope: "openid"})
+	err = testRepo.SaveOAuthConsent(data.OAuthConsent{UserID: 1, ClientID: "test-client", Scope: "openid profile"})
+
+	if err != nil {
+		t.Errorf("Error saving consent: %s", err)
+	}
+
+	consent, _ := testRepo.GetOAuthConsent(1, "test-client")
+
+	if consent == nil || consent.Scope != "openid profile" {
+		t.Errorf("Incorrect consent returned: %v", consent)
+	}
+}
+
+func Test_PostgresDBRepo_ConfidentialOAuthClient(t *testing.T) {
+	_, err := testRepo.InsertOAuthClient(data.OAuthClient{
+		ClientID:   "service-client",
+		Name:       "Service",
+		Scopes:     []string{"users:read"},
+		SecretHash: "secret-hash",
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting OAuth client: %s", err)
+	}
+
+	client, _ := testRepo.GetOAuthClient("service-client")
+
+	if client == nil || !client.Confidential() || client.SecretHash != "secret-hash" || len(client.RedirectURIs) != 0 {
+		t.Errorf("Incorrect OAuth client returned: %v", client)
+	}
+
+	client, _ = testRepo.GetOAuthClient("test-client")
+
+	if client == nil || client.Confidential() {
+		t.Errorf("Expected the public client to have no secret: %v", client)
+	}
+}
+
+func Test_PostgresDBRepo_APIKeys(t *testing.T) {
+	id, err := testRepo.InsertAPIKey(data.APIKey{
+		UserID:  1,
+		Name:    "deploy",
+		Prefix:  "key_abcdefgh",
+		KeyHash: "api-key-hash",
+		Scopes:  []string{"users:read"},
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting API key: %s", err)
+	}
+
+	key, err := testRepo.GetAPIKey("api-key-hash")
+
+	if err != nil || key.ID != id || key.Name != "deploy" || len(key.Scopes) != 1 || key.LastUsedAt != nil {
+		t.Errorf("Incorrect API key returned: %v, %v", key, err)
+	}
+
+	_ = testRepo.MarkAPIKeyUsed(id)
+
+	keys, err := testRepo.GetUserAPIKeys(1)
+
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected 1 used API key, got %v, %v", keys, err)
+	}
+
+	err = testRepo.DeleteAPIKey(2, id)
+
+	if err == nil {
+		t.Errorf("Should not have been able to delete another user's API key")
+	}
+
+	err = testRepo.DeleteAPIKey(1, id)
+
+	if err != nil {
+		t.Errorf("Error deleting API key: %s", err)
+	}
+
+	_, err = testRepo.GetAPIKey("api-key-hash")
+
+	if err == nil {
+		t.Errorf("Expected the deleted API key to be gone")
+	}
+}
+
+func Test_PostgresDBRepo_Sessions(t *testing.T) {
+	_, _ = testRepo.InsertRefreshToken(data.RefreshToken{
+		UserID:    1,
+		FamilyID:  "session-family",
+		TokenHash: "session-token-hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	id, err := testRepo.InsertSession(data.Session{
+		UserID:    1,
+		FamilyID:  "session-family",
+		UserAgent: "Firefox",
+		IPAddress: "192.0.2.1",
+	})
+
+	if err != nil {
+		t.Errorf("Error inserting session: %s", err)
+	}
+
+	sessions, err := testRepo.GetUserSessions(1)
+
+	if err != nil || len(sessions) != 1 || sessions[0].ID != id || sessions[0].UserAgent != "Firefox" {
+		t.Fatalf("Expected the active session, got %v, %v", sessions, err)
+	}
+
+	created := sessions[0].LastUsedAt
+
+	err = testRepo.MarkSessionUsed("session-family")
+
+	if err != nil {
+		t.Errorf("Error marking session used: %s", err)
+	}
+
+	sessions, _ = testRepo.GetUserSessions(1)
+
+	if len(sessions) != 1 || !sessions[0].LastUsedAt.After(created) {
+		t.Errorf("Expected the session's last used time to move on")
+	}
+
+	_ = testRepo.RevokeRefreshTokenFamily("session-family")
+
+	sessions, _ = testRepo.GetUserSessions(1)
+
+	if len(sessions) != 0 {
+		t.Errorf("Expected no active sessions once the family was revoked, got %d", len(sessions))
+	}
+}
+
+func Test_PostgresDBRepo_AuditLog(t *testing.T) {
+	for _, action := range []string{"impersonate", "GET /me"} {
+		_, err := testRepo.InsertAuditEvent(data.AuditEvent{
+			ActorID:   1,
+			UserID:    2,
+			Action:    action,
+			Status:    200,
+			IPAddress: "192.0.2.1",
+		})
+
+		if err != nil {
+			t.Errorf("Error inserting audit event: %s", err)
+		}
+	}
+
+	events, err := testRepo.GetUserAuditEvents(2)
+
+	if err != nil {
+		t.Errorf("Error getting audit log: %s", err)
+	}
+
+	if len(events) != 2 || events[0].Action != "GET /me" || events[1].Action != "impersonate" {
+		t.Errorf("Expected both events, newest first, got %v", events)
+	}
+
+	events, _ = testRepo.GetUserAuditEvents(1)
+
+	if len(events) != 0 {
+		t.Errorf("Expected no events about the admin themselves, got %d", len(events))
+	}
+}
+
+func Test_PostgresDBRepo_ListUsers(t *testing.T) {
+	for _, name := range []string{"Cole", "Abbott", "Baker"} {
+		_, _ = testRepo.InsertUser(data.User{
+			FirstName: "List",
+			LastName:  name,
+			Email:     strings.ToLower(name) + "@list.example.com",
+			Password:  "secret",
+		})
+	}
+
+	since := time.Now().Add(-time.Minute)
+
+	users, total, err := testRepo.ListUsers(repository.UserListOptions{
+		Limit:        2,
+		CreatedAfter: &since,
+	})
+
+	if err != nil {
+		t.Fatalf("Error listing users: %s", err)
+	}
+
+	if total < 3 || len(users) != 2 {
+		t.Fatalf("Expected a page of 2 of at least 3 users, got %d of %d", len(users), total)
+	}
+
+	if users[0].LastName > users[1].LastName {
+		t.Errorf("Expected users in last name order, got %s before %s", users[0].LastName, users[1].LastName)
+	}
+
+	users, total, _ = testRepo.ListUsers(repository.UserListOptions{Email: "BAKER@list.example.com"})
+
+	if total != 1 || len(users) != 1 || users[0].LastName != "Baker" {
+		t.Errorf("Expected to find Baker by email, got %d users", total)
+	}
+
+	isAdmin := true
+
+	users, _, _ = testRepo.ListUsers(repository.UserListOptions{IsAdmin: &isAdmin, Sort: "id", Descending: true})
+
+	for i, u := range users {
+		if u.IsAdmin != 1 {
+			t.Errorf("Expected only admins, got %s", u.Email)
+		}
+
+		if i > 0 && u.ID > users[i-1].ID {
+			t.Errorf("Expected users in descending id order")
+		}
+	}
+
+	_, _, err = testRepo.ListUsers(repository.UserListOptions{Sort: "password"})
+
+	if err == nil {
+		t.Errorf("Expected an error sorting by a column that isn't allowed")
+	}
+}
+
+func Test_PostgresDBRepo_SearchUsers(t *testing.T) {
+	_, _ = testRepo.InsertUser(data.User{
+		FirstName: "Margaret",
+		LastName:  "Thornbury",
+		Email:     "mthornbury@search.example.com",
+		Password:  "secret",
+	})
+
+	_, _ = testRepo.InsertUser(data.User{
+		FirstName: "Thorn",
+		LastName:  "Whitfield",
+		Email:     "thorn@search.example.com",
+		Password:  "secret",
+	})
+
+	results, total, err := testRepo.SearchUsers("thorn", 10, 0)
+
+	if err != nil {
+		t.Fatalf("Error searching users: %s", err)
+	}
+
+	if total != 2 || len(results) != 2 {
+		t.Fatalf("Expected 2 users matching thorn, got %d", total)
+	}
+
+	if results[0].LastName != "Whitfield" || results[0].Rank < results[1].Rank {
+		t.Errorf("Expected the whole word match first, got %s", results[0].LastName)
+	}
+
+	// a typo still finds them
+	results, _, _ = testRepo.SearchUsers("thornbery", 10, 0)
+
+	if len(results) == 0 || results[0].LastName != "Thornbury" {
+		t.Errorf("Expected a close match for a misspelled name")
+	}
+
+	// LIKE wildcards are matched literally
+	_, total, _ = testRepo.SearchUsers("%", 10, 0)
+
+	if total != 0 {
+		t.Errorf("Expected no users matching %%, got %d", total)
+	}
+
+	results, total, _ = testRepo.SearchUsers("search.example.com", 1, 1)
+
+	if total != 2 || len(results) != 1 {
+		t.Errorf("Expected the second page of 2 results, got %d of %d", len(results), total)
+	}
+}
+
+func Test_PostgresDBRepo_UserVersions(t *testing.T) {
+	id, _ := testRepo.InsertUser(data.User{
+		FirstName: "Version",
+		LastName:  "Tester",
+		Email:     "version@example.com",
+		Password:  "secret",
+	})
+
+	user, _ := testRepo.GetUser(id)
+
+	if user.Version != 1 {
+		t.Fatalf("Expected a new user to be at version 1, got %d", user.Version)
+	}
+
+	user.FirstName = "First"
+
+	err := testRepo.UpdateUser(*user)
+
+	if err != nil {
+		t.Fatalf("Error updating user: %s", err)
+	}
+
+	// a second update from the same, now stale, copy
+	user.FirstName = "Second"
+
+	err = testRepo.UpdateUser(*user)
+
+	var conflict *repository.VersionConflictError
+
+	if !errors.As(err, &conflict) || conflict.CurrentVersion != 2 {
+		t.Fatalf("Expected a version conflict at version 2, got %v", err)
+	}
+
+	updated, _ := testRepo.GetUser(id)
+
+	if updated.FirstName != "First" || updated.Version != 2 {
+		t.Errorf("Expected the first update to stand, got %s at version %d", updated.FirstName, updated.Version)
+	}
+
+	err = testRepo.DeleteUserAtVersion(id, 1)
+
+	if !errors.As(err, &conflict) {
+		t.Errorf("Expected a version conflict deleting a stale version, got %v", err)
+	}
+
+	err = testRepo.DeleteUserAtVersion(id, 2)
+
+	if err != nil {
+		t.Errorf("Error deleting user: %s", err)
+	}
+
+	err = testRepo.DeleteUserAtVersion(id, 2)
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows deleting a deleted user, got %v", err)
+	}
+}
@@ -3,11 +3,37 @@ package dbrepo
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/spartanhooah/testing-rest-api/data"
+	"github.com/spartanhooah/testing-rest-api/db/repository"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-type TestDBRepo struct{}
+// TestDBRepo is an in-memory DatabaseRepo for tests. Users are hardcoded; tables added
+// since then keep their rows in the fields below.
+type TestDBRepo struct {
+	mu            sync.Mutex
+	refreshTokens []*data.RefreshToken
+	revokedTokens map[string]time.Time
+	userRoles     map[int][]string
+	userTokens    []*data.UserToken
+	emailVerified map[int]time.Time
+	loginFailures map[string]*data.LoginFailures
+	mfa           map[int]*data.MFA
+	recoveryCodes map[int]map[string]bool
+	oauthClients  []*data.OAuthClient
+	authCodes     []*data.AuthorizationCode
+	oauthConsents []*data.OAuthConsent
+	apiKeys       []*data.APIKey
+	apiKeyID      int
+	sessions      []*data.Session
+	auditLog      []*data.AuditEvent
+	userVersions  map[int]int
+}
 
 func (m *TestDBRepo) Connection() *sql.DB {
 	return nil
@@ -20,6 +46,141 @@ func (m *TestDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+// testUsers are the users ListUsers pages through. Only the first can be looked up by id or email.
+func testUsers() []data.User {
+	created := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	return []data.User{
+		{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1, CreatedAt: created},
+		{ID: 2, FirstName: "Jack", LastName: "Smith", Email: "jack@smith.com", CreatedAt: created.AddDate(0, 1, 0)},
+		{ID: 3, FirstName: "Jill", LastName: "Smith", Email: "jill@smith.com", CreatedAt: created.AddDate(0, 2, 0)},
+		{ID: 4, FirstName: "Ann", LastName: "Jones", Email: "ann@jones.com", IsAdmin: 1, CreatedAt: created.AddDate(0, 3, 0)},
+		{ID: 5, FirstName: "Bob", LastName: "Brown", Email: "bob@brown.com", CreatedAt: created.AddDate(0, 4, 0)},
+	}
+}
+
+// ListUsers returns one page of the users matching opts, along with how many users match in all
+func (m *TestDBRepo) ListUsers(opts repository.UserListOptions) ([]*data.User, int, error) {
+	sortBy := opts.Sort
+
+	if sortBy == "" {
+		sortBy = "last_name"
+	}
+
+	if !slices.Contains(repository.UserSortColumns, sortBy) {
+		return nil, 0, fmt.Errorf("cannot sort users by %s", sortBy)
+	}
+
+	var users []*data.User
+
+	for _, user := range testUsers() {
+		if opts.Email != "" && !strings.EqualFold(user.Email, opts.Email) {
+			continue
+		}
+
+		if opts.IsAdmin != nil && (user.IsAdmin == 1) != *opts.IsAdmin {
+			continue
+		}
+
+		if opts.CreatedAfter != nil && !user.CreatedAt.After(*opts.CreatedAfter) {
+			continue
+		}
+
+		m.applyEmailVerification(&user)
+		users = append(users, &user)
+	}
+
+	key := func(u *data.User) string {
+		switch sortBy {
+		case "first_name":
+			return u.FirstName
+		case "last_name":
+			return u.LastName
+		case "email":
+			return u.Email
+		case "created_at":
+			return u.CreatedAt.Format(time.RFC3339Nano)
+		}
+
+		return ""
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+
+		if opts.Descending {
+			a, b = b, a
+		}
+
+		if key(a) != key(b) {
+			return key(a) < key(b)
+		}
+
+		return a.ID < b.ID
+	})
+
+	total := len(users)
+
+	users = users[min(opts.Offset, total):]
+
+	if opts.Limit > 0 && len(users) > opts.Limit {
+		users = users[:opts.Limit]
+	}
+
+	return users, total, nil
+}
+
+// SearchUsers finds users whose name or email contains query, ignoring case. Unlike Postgres it
+// doesn't allow for typos. Users are ranked by how much of the matching field the query covers.
+func (m *TestDBRepo) SearchUsers(query string, limit, offset int) ([]*data.UserSearchResult, int, error) {
+	query = strings.ToLower(query)
+
+	var results []*data.UserSearchResult
+
+	for _, user := range testUsers() {
+		var rank float64
+
+		fields := []string{user.FirstName, user.LastName, user.FirstName + " " + user.LastName, user.Email}
+
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), query) {
+				rank = max(rank, float64(len(query))/float64(len(field)))
+			}
+		}
+
+		if rank == 0 {
+			continue
+		}
+
+		m.applyEmailVerification(&user)
+		results = append(results, &data.UserSearchResult{User: user, Rank: rank})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+
+		return a.ID < b.ID
+	})
+
+	total := len(results)
+
+	results = results[min(offset, total):]
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, total, nil
+}
+
 // GetUser returns one user by id
 func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 	if id == 1 {
@@ -28,8 +189,12 @@ func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 			FirstName: "Admin",
 			LastName:  "User",
 			Email:     "admin@example.com",
+			Password:  "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
 		}
 
+		m.applyEmailVerification(&user)
+		user.Version = m.userVersion(user.ID)
+
 		return &user, nil
 	}
 
@@ -39,7 +204,7 @@ func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 // GetUserByEmail returns one user by email address
 func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
 	if email == "admin@example.com" {
-		return &data.User{
+		user := data.User{
 			ID:        1,
 			FirstName: "Admin",
 			LastName:  "User",
@@ -48,19 +213,36 @@ func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
 			IsAdmin:   1,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
-		}, nil
+		}
+
+		m.applyEmailVerification(&user)
+		user.Version = m.userVersion(user.ID)
+
+		return &user, nil
 	}
 
 	return nil, errors.New("User not found")
 }
 
-// UpdateUser updates one user in the database
+// UpdateUser updates one user in the database. If u.Version is set, the user must still be at that
+// version. Only the version is kept; the user's fields stay as they are hardcoded.
 func (m *TestDBRepo) UpdateUser(u data.User) error {
-	if u.ID == 1 {
-		return nil
+	if u.ID != 1 {
+		return errors.New("Update failed; no user found")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.checkUserVersion(u.ID, u.Version)
+
+	if err != nil {
+		return err
 	}
 
-	return errors.New("Update failed; no user found")
+	m.bumpUserVersion(u.ID)
+
+	return nil
 }
 
 // DeleteUser deletes one user from the database, by id
@@ -68,6 +250,50 @@ func (m *TestDBRepo) DeleteUser(id int) error {
 	return nil
 }
 
+// DeleteUserAtVersion deletes one user from the database, by id, if they are still at version
+func (m *TestDBRepo) DeleteUserAtVersion(id, version int) error {
+	if id != 1 {
+		return sql.ErrNoRows
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.checkUserVersion(id, version)
+}
+
+func (m *TestDBRepo) userVersion(id int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.currentUserVersion(id)
+}
+
+// currentUserVersion, checkUserVersion and bumpUserVersion must be called with m.mu held
+func (m *TestDBRepo) currentUserVersion(id int) int {
+	if version, ok := m.userVersions[id]; ok {
+		return version
+	}
+
+	return 1
+}
+
+func (m *TestDBRepo) checkUserVersion(id, version int) error {
+	if current := m.currentUserVersion(id); version != 0 && version != current {
+		return &repository.VersionConflictError{ID: id, Version: version, CurrentVersion: current}
+	}
+
+	return nil
+}
+
+func (m *TestDBRepo) bumpUserVersion(id int) {
+	if m.userVersions == nil {
+		m.userVersions = make(map[int]int)
+	}
+
+	m.userVersions[id] = m.currentUserVersion(id) + 1
+}
+
 // InsertUser inserts a new user into the database, and returns the ID of the newly inserted row
 func (m *TestDBRepo) InsertUser(user data.User) (int, error) {
 	return 2, nil
@@ -78,6 +304,35 @@ func (m *TestDBRepo) ResetPassword(id int, password string) error {
 	return nil
 }
 
+// MarkEmailVerified records that a user has proven they own their email address
+func (m *TestDBRepo) MarkEmailVerified(id int, email string) error {
+	if id != 1 || email != "admin@example.com" {
+		return errors.New("user not found")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailVerified == nil {
+		m.emailVerified = make(map[int]time.Time)
+	}
+
+	m.emailVerified[id] = time.Now()
+	m.bumpUserVersion(id)
+
+	return nil
+}
+
+func (m *TestDBRepo) applyEmailVerification(user *data.User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if verifiedAt, ok := m.emailVerified[user.ID]; ok {
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &verifiedAt
+	}
+}
+
 // InsertUserImage inserts a user profile image into the database.
 func (m *TestDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 	return 1, nil
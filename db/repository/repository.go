@@ -2,17 +2,115 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/spartanhooah/testing-rest-api/data"
+	"time"
 )
 
+// ErrRefreshTokenUsed is returned when a refresh token is marked as used a second time.
+var ErrRefreshTokenUsed = errors.New("refresh token has already been used")
+
+// ErrMFACodeUsed is returned when a TOTP code from the same or an earlier time step is used again.
+var ErrMFACodeUsed = errors.New("code has already been used")
+
+// VersionConflictError is returned when a user is updated or deleted at a version that is no longer
+// current, because someone else changed them first.
+type VersionConflictError struct {
+	ID             int
+	Version        int
+	CurrentVersion int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("user %d is at version %d, not %d", e.ID, e.CurrentVersion, e.Version)
+}
+
+// UserSortColumns are the columns users can be sorted by. ListUsers breaks ties by id.
+var UserSortColumns = []string{"id", "first_name", "last_name", "email", "created_at"}
+
+// UserListOptions selects a page of users for ListUsers. Zero values mean no filter.
+type UserListOptions struct {
+	// Limit of 0 returns every matching user
+	Limit  int
+	Offset int
+
+	// Sort is one of UserSortColumns; it defaults to last_name
+	Sort       string
+	Descending bool
+
+	// Email matches the whole address, ignoring case
+	Email        string
+	IsAdmin      *bool
+	CreatedAfter *time.Time
+}
+
 type DatabaseRepo interface {
 	Connection() *sql.DB
+	// AllUsers is no longer used by the handlers, which page through ListUsers, but is kept for
+	// tooling and tests which need every user at once
 	AllUsers() ([]*data.User, error)
+	ListUsers(opts UserListOptions) ([]*data.User, int, error)
+	SearchUsers(query string, limit, offset int) ([]*data.UserSearchResult, int, error)
 	GetUser(id int) (*data.User, error)
 	GetUserByEmail(email string) (*data.User, error)
 	UpdateUser(u data.User) error
 	DeleteUser(id int) error
+	DeleteUserAtVersion(id, version int) error
 	InsertUser(user data.User) (int, error)
 	ResetPassword(id int, password string) error
+	MarkEmailVerified(id int, email string) error
 	InsertUserImage(i data.UserImage) (int, error)
+
+	InsertRefreshToken(t data.RefreshToken) (int, error)
+	GetRefreshToken(tokenHash string) (*data.RefreshToken, error)
+	MarkRefreshTokenUsed(id int) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+
+	InsertSession(s data.Session) (int, error)
+	GetUserSessions(userID int) ([]*data.Session, error)
+	MarkSessionUsed(familyID string) error
+
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti, familyID string) (bool, error)
+
+	AllRoles() ([]*data.Role, error)
+	GetRole(name string) (*data.Role, error)
+	GetUserRoles(userID int) ([]*data.Role, error)
+	AssignRole(userID int, role string) error
+	RemoveRole(userID int, role string) error
+
+	InsertUserToken(t data.UserToken) (int, error)
+	ConsumeUserToken(tokenHash, purpose string) (*data.UserToken, error)
+
+	GetLoginFailures(key string) (*data.LoginFailures, error)
+	RecordLoginFailure(key string, window time.Duration) (*data.LoginFailures, error)
+	LockLogin(key string, until time.Time) error
+	ClearLoginFailures(key string) error
+
+	GetMFA(userID int) (*data.MFA, error)
+	SetMFASecret(userID int, secret string) error
+	ConfirmMFA(userID int, step int64, recoveryCodeHashes []string) error
+	UseMFAStep(userID int, step int64) error
+	ReplaceRecoveryCodes(userID int, recoveryCodeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) error
+	DeleteMFA(userID int) error
+
+	AllOAuthClients() ([]*data.OAuthClient, error)
+	GetOAuthClient(clientID string) (*data.OAuthClient, error)
+	InsertOAuthClient(c data.OAuthClient) (int, error)
+	InsertAuthorizationCode(c data.AuthorizationCode) (int, error)
+	ConsumeAuthorizationCode(codeHash string) (*data.AuthorizationCode, error)
+	GetOAuthConsent(userID int, clientID string) (*data.OAuthConsent, error)
+	SaveOAuthConsent(c data.OAuthConsent) error
+
+	GetUserAPIKeys(userID int) ([]*data.APIKey, error)
+	GetAPIKey(keyHash string) (*data.APIKey, error)
+	InsertAPIKey(k data.APIKey) (int, error)
+	MarkAPIKeyUsed(id int) error
+	DeleteAPIKey(userID, id int) error
+
+	InsertAuditEvent(e data.AuditEvent) (int, error)
+	GetUserAuditEvents(userID int) ([]*data.AuditEvent, error)
 }
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Message_bytes(t *testing.T) {
+	msg := Message{
+		To:      "jack@example.com\r\nBcc: everyone@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two",
+	}
+
+	out := string(msg.bytes("noreply@example.com"))
+
+	if !strings.Contains(out, "From: noreply@example.com\r\n") {
+		t.Errorf("missing From header: %q", out)
+	}
+
+	if strings.Contains(out, "\r\nBcc:") {
+		t.Errorf("recipient was able to inject a header: %q", out)
+	}
+
+	if !strings.HasSuffix(out, "\r\n\r\nline one\r\nline two") {
+		t.Errorf("body not separated from headers or line endings not converted: %q", out)
+	}
+}
+
+func Test_MemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+
+	_ = m.Send(Message{To: "jack@example.com", Subject: "first"})
+	_ = m.Send(Message{To: "jill@example.com", Subject: "second"})
+	_ = m.Send(Message{To: "jack@example.com", Subject: "third"})
+
+	if len(m.Messages()) != 3 {
+		t.Errorf("expected 3 messages, got %d", len(m.Messages()))
+	}
+
+	last, ok := m.Last("jack@example.com")
+
+	if !ok || last.Subject != "third" {
+		t.Errorf("expected the last message to jack to be \"third\", got %q", last.Subject)
+	}
+
+	if _, ok := m.Last("nobody@example.com"); ok {
+		t.Errorf("expected no message for an address nothing was sent to")
+	}
+}
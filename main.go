@@ -6,19 +6,67 @@ import (
 	"fmt"
 	"github.com/spartanhooah/testing-rest-api/application"
 	"github.com/spartanhooah/testing-rest-api/db/repository/dbrepo"
+	"github.com/spartanhooah/testing-rest-api/mailer"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const port = 8090
 
 func main() {
 	var app application.Application
+	var signingKeyFile, keyDir string
+	var smtpMailer mailer.SMTPMailer
 	flag.StringVar(&app.Datasource, "datasource", "host=localhost port=5432 user=postgres password=postgres dbname=users sslmode=disable timezone=UTC connect_timeout=5", "Postgres connection")
 	flag.StringVar(&app.Domain, "domain", "example.com", "Domain for application, e.g. company.com")
+	flag.StringVar(&app.BaseURL, "base-url", fmt.Sprintf("http://localhost:%d", port), "URL the application is served from; used in links we email")
 	flag.StringVar(&app.JWTSecret, "jwt-secret", "super-secret", "signing secret")
+	flag.StringVar(&signingKeyFile, "jwt-key", "", "PEM file with an RSA or Ed25519 private key; signs with the key pair instead of jwt-secret")
+	flag.StringVar(&keyDir, "jwt-keys", "", "directory of .pem and .secret key files; the last file by name signs, and SIGHUP reloads the directory")
+	flag.BoolVar(&app.RequireVerifiedEmail, "require-verified-email", false, "refuse logins from users who haven't verified their email address")
+	flag.IntVar(&app.MaxLoginFailures, "max-login-failures", 5, "failed logins allowed for one email address before it is locked out; 0 for no limit")
+	flag.IntVar(&app.MaxLoginFailuresPerIP, "max-login-failures-per-ip", 50, "failed logins allowed from one IP address before it is locked out; 0 for no limit")
+	flag.DurationVar(&app.TokenLeeway, "token-leeway", 30*time.Second, "clock skew allowed when checking the exp, nbf and iat times of tokens")
+	flag.StringVar(&smtpMailer.Host, "smtp-host", "", "SMTP server for outgoing email; if empty, email is written to the log instead")
+	flag.IntVar(&smtpMailer.Port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&smtpMailer.Username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&smtpMailer.Password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&smtpMailer.From, "mail-from", "noreply@example.com", "From address for outgoing email")
 	flag.Parse()
 
+	if smtpMailer.Host != "" {
+		app.Mailer = &smtpMailer
+	} else {
+		app.Mailer = &mailer.LogMailer{}
+	}
+
+	switch {
+	case keyDir != "":
+		keys, err := application.LoadKeyring(keyDir)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		app.Keys = keys
+
+		go reloadKeysOnHangup(keys, keyDir)
+	case signingKeyFile != "":
+		key, err := application.LoadSigningKey(signingKeyFile)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		app.Keys = application.NewKeyring(key)
+	default:
+		app.Keys = application.NewKeyring(application.NewHMACKey(app.JWTSecret))
+	}
+
 	conn, err := app.ConnectToDB()
 
 	if err != nil {
@@ -42,3 +90,21 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// reloadKeysOnHangup re-reads the key directory whenever the process receives SIGHUP, so keys can
+// be rotated and retired without a restart
+func reloadKeysOnHangup(keys *application.Keyring, keyDir string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		err := keys.Reload(keyDir)
+
+		if err != nil {
+			log.Println("Error reloading signing keys; keeping the current keys:", err)
+			continue
+		}
+
+		log.Printf("Reloaded signing keys; signing with %s\n", keys.Active().ID)
+	}
+}
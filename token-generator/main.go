@@ -8,6 +8,10 @@ import (
 	"time"
 )
 
+// adminPermissions mirrors the permissions of the admin role seeded in testdata/users.sql; routes
+// check permissions rather than the admin claim, so the token has to carry them
+var adminPermissions = []string{"clients:manage", "roles:manage", "sessions:revoke", "users:delete", "users:impersonate", "users:read", "users:write"}
+
 type application struct {
 	JWTSecret string
 	Action    string
@@ -29,9 +33,12 @@ func main() {
 
 	// set claims
 	claims := token.Claims.(jwt.MapClaims)
+	claims["typ"] = "access"
 	claims["name"] = "John Doe"
 	claims["sub"] = "1"
 	claims["admin"] = true
+	claims["roles"] = []string{"admin"}
+	claims["permissions"] = adminPermissions
 	claims["aud"] = "example.com"
 	claims["iss"] = "example.com"
 	// leave this to 3 days, for easy manual testing